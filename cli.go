@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/glebson1988/chirpy/internal/auth"
+	"github.com/glebson1988/chirpy/internal/database"
+)
+
+// runCommand runs a maintenance command given on the command line instead
+// of starting the server.
+func runCommand(dbURL string, args []string) error {
+	switch args[0] {
+	case "create-admin":
+		if len(args) != 2 {
+			return errors.New("usage: chirpy create-admin <email>")
+		}
+
+		db, err := sql.Open("postgres", dbURL)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		return createAdmin(context.Background(), database.New(db), args[1], os.Stdin, os.Stdout)
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+type adminStore interface {
+	GetUserByEmail(ctx context.Context, email string) (database.User, error)
+	CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error)
+	MarkEmailVerified(ctx context.Context, arg database.MarkEmailVerifiedParams) (int64, error)
+	SetUserRole(ctx context.Context, arg database.SetUserRoleParams) (database.User, error)
+}
+
+// createAdmin makes the account with email an admin. If there is no such
+// account it is created, already verified, with a password read from the
+// first line of in, so it never ends up in shell history.
+func createAdmin(ctx context.Context, db adminStore, email string, in io.Reader, out io.Writer) error {
+	user, err := db.GetUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		fmt.Fprintf(out, "No account for %s yet; enter a password for it: ", email)
+
+		scanner := bufio.NewScanner(in)
+		scanner.Scan()
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+		password := strings.TrimRight(scanner.Text(), "\r")
+		if password == "" {
+			return errors.New("password can't be empty")
+		}
+
+		hashedPassword, err := auth.HashPassword(password)
+		if err != nil {
+			return err
+		}
+		user, err = db.CreateUser(ctx, database.CreateUserParams{
+			Email:          email,
+			HashedPassword: hashedPassword,
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := db.MarkEmailVerified(ctx, database.MarkEmailVerifiedParams{ID: user.ID, Email: user.Email}); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	if _, err := db.SetUserRole(ctx, database.SetUserRoleParams{ID: user.ID, Role: auth.RoleAdmin}); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "%s is now an admin\n", email)
+	return nil
+}
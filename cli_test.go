@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/glebson1988/chirpy/internal/auth"
+	"github.com/glebson1988/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+type stubAdminStore struct {
+	users    map[string]database.User
+	verified map[uuid.UUID]bool
+}
+
+func (s *stubAdminStore) GetUserByEmail(ctx context.Context, email string) (database.User, error) {
+	user, ok := s.users[email]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (s *stubAdminStore) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error) {
+	user := database.User{ID: uuid.New(), Email: arg.Email, HashedPassword: arg.HashedPassword, Role: auth.RoleUser}
+	s.users[arg.Email] = user
+	return user, nil
+}
+
+func (s *stubAdminStore) MarkEmailVerified(ctx context.Context, arg database.MarkEmailVerifiedParams) (int64, error) {
+	s.verified[arg.ID] = true
+	return 1, nil
+}
+
+func (s *stubAdminStore) SetUserRole(ctx context.Context, arg database.SetUserRoleParams) (database.User, error) {
+	for email, user := range s.users {
+		if user.ID == arg.ID {
+			user.Role = arg.Role
+			s.users[email] = user
+			return user, nil
+		}
+	}
+	return database.User{}, sql.ErrNoRows
+}
+
+func TestCreateAdmin(t *testing.T) {
+	existing := database.User{ID: uuid.New(), Email: "mod@example.com", Role: auth.RoleModerator}
+	db := &stubAdminStore{
+		users:    map[string]database.User{existing.Email: existing},
+		verified: map[uuid.UUID]bool{},
+	}
+
+	var out bytes.Buffer
+	if err := createAdmin(context.Background(), db, existing.Email, strings.NewReader(""), &out); err != nil {
+		t.Fatalf("createAdmin() error = %v", err)
+	}
+	if got := db.users[existing.Email]; got.Role != auth.RoleAdmin || got.ID != existing.ID {
+		t.Fatalf("existing user = %+v, want promoted to admin", got)
+	}
+
+	if err := createAdmin(context.Background(), db, "root@example.com", strings.NewReader("hunter2\n"), &out); err != nil {
+		t.Fatalf("createAdmin() error = %v", err)
+	}
+	created := db.users["root@example.com"]
+	if created.Role != auth.RoleAdmin || !db.verified[created.ID] {
+		t.Fatalf("created user = %+v, want a verified admin", created)
+	}
+	if ok, err := auth.CheckPasswordHash("hunter2", created.HashedPassword); err != nil || !ok {
+		t.Fatalf("created user's password doesn't match: %v", err)
+	}
+
+	if err := createAdmin(context.Background(), db, "nobody@example.com", strings.NewReader("\n"), &out); err == nil {
+		t.Fatal("createAdmin() expected error for an empty password")
+	}
+}
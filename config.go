@@ -2,25 +2,41 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"sync/atomic"
 
+	"github.com/glebson1988/chirpy/internal/auth"
 	"github.com/glebson1988/chirpy/internal/database"
+	"github.com/glebson1988/chirpy/internal/mailer"
 	"github.com/google/uuid"
 )
 
 type apiConfig struct {
 	fileserverHits atomic.Int32
 	db             *database.Queries
+	dbConn         *sql.DB
 	platform       string
-	tokenSecret    string
+	tokenKeys      *auth.Keyring
 	tokenStore     tokenStore
 	userStore      userStore
 	polkaKey       string
+	mailer         mailer.Mailer
+	baseURL        string
+	webauthn       auth.WebAuthnRelyingParty
+	// requireEmailVerification stops users from chirping until they have
+	// verified their email address.
+	requireEmailVerification bool
 }
 
 type tokenStore interface {
-	GetUserFromRefreshToken(ctx context.Context, token string) (database.GetUserFromRefreshTokenRow, error)
-	RevokeRefreshToken(ctx context.Context, token string) error
+	CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) error
+	GetUserFromRefreshToken(ctx context.Context, id string) (database.GetUserFromRefreshTokenRow, error)
+	RevokeRefreshToken(ctx context.Context, id string) error
+	RevokeActiveRefreshToken(ctx context.Context, id string) (int64, error)
+	RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error
+	GetPersonalAccessToken(ctx context.Context, tokenHash string) (database.PersonalAccessToken, error)
+	TouchPersonalAccessToken(ctx context.Context, id uuid.UUID) error
+	GetUserStanding(ctx context.Context, id uuid.UUID) (database.GetUserStandingRow, error)
 }
 
 type userStore interface {
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/glebson1988/chirpy/internal/database"
+	"github.com/lib/pq"
+)
+
+// fakeDB stands in for Postgres in handler tests. Each query is answered by
+// the function registered for its sqlc name with on; queries nobody
+// registered return no rows. Every statement is recorded so tests can check
+// what was written and whether its transaction committed.
+type fakeDB struct {
+	mu       sync.Mutex
+	handlers map[string]func(args []driver.Value) fakeResult
+	queries  []*fakeQuery
+}
+
+type fakeResult struct {
+	rows         [][]driver.Value
+	rowsAffected int64
+	err          error
+}
+
+type fakeQuery struct {
+	name string
+	args []driver.Value
+	tx   *fakeTx
+}
+
+// committed reports whether the statement ran outside a transaction or in
+// one that committed.
+func (q *fakeQuery) committed() bool {
+	return q.tx == nil || q.tx.committed
+}
+
+// newFakeDBConfig returns an apiConfig whose db, dbConn and tokenStore are
+// backed by a new fakeDB.
+func newFakeDBConfig(t *testing.T) (*apiConfig, *fakeDB) {
+	t.Helper()
+
+	fake := &fakeDB{handlers: make(map[string]func(args []driver.Value) fakeResult)}
+	conn := sql.OpenDB(fake)
+	t.Cleanup(func() { conn.Close() })
+
+	queries := database.New(conn)
+	return &apiConfig{
+		db:         queries,
+		dbConn:     conn,
+		tokenStore: queries,
+		tokenKeys:  newTestKeyring(t),
+	}, fake
+}
+
+func (db *fakeDB) on(name string, handler func(args []driver.Value) fakeResult) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.handlers[name] = handler
+}
+
+// calls returns the statements run for the named query, in order.
+func (db *fakeDB) calls(name string) []*fakeQuery {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var calls []*fakeQuery
+	for _, q := range db.queries {
+		if q.name == name {
+			calls = append(calls, q)
+		}
+	}
+	return calls
+}
+
+// committedCalls is calls without the statements that were rolled back.
+func (db *fakeDB) committedCalls(name string) []*fakeQuery {
+	var committed []*fakeQuery
+	for _, q := range db.calls(name) {
+		if q.committed() {
+			committed = append(committed, q)
+		}
+	}
+	return committed
+}
+
+func (db *fakeDB) run(query string, args []driver.NamedValue, tx *fakeTx) fakeResult {
+	name := queryName(query)
+	values := make([]driver.Value, 0, len(args))
+	for _, arg := range args {
+		values = append(values, arg.Value)
+	}
+
+	db.mu.Lock()
+	db.queries = append(db.queries, &fakeQuery{name: name, args: values, tx: tx})
+	handler := db.handlers[name]
+	db.mu.Unlock()
+
+	if handler == nil {
+		return fakeResult{}
+	}
+	return handler(values)
+}
+
+// queryName reads the name sqlc puts on the first line of every query.
+func queryName(query string) string {
+	line, _, _ := strings.Cut(query, "\n")
+	fields := strings.Fields(strings.TrimPrefix(line, "-- name:"))
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+// fakeRows answers a query with one row per struct, with the struct's
+// fields as columns in order, the way sqlc scans them. Anything else that
+// isn't a struct is a row with a single column.
+func fakeRows(rows ...any) fakeResult {
+	result := fakeResult{rows: make([][]driver.Value, 0, len(rows))}
+	for _, row := range rows {
+		value := reflect.ValueOf(row)
+		if value.Kind() != reflect.Struct || value.Type() == timeType || value.Type().Implements(valuerType) {
+			result.rows = append(result.rows, []driver.Value{fakeValue(row)})
+			continue
+		}
+		columns := make([]driver.Value, 0, value.NumField())
+		for i := 0; i < value.NumField(); i++ {
+			columns = append(columns, fakeValue(value.Field(i).Interface()))
+		}
+		result.rows = append(result.rows, columns)
+	}
+	return result
+}
+
+var (
+	valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+	timeType   = reflect.TypeOf(time.Time{})
+)
+
+func fakeValue(v any) driver.Value {
+	switch v := v.(type) {
+	case []string:
+		value, _ := pq.StringArray(v).Value()
+		return value
+	case driver.Valuer:
+		value, err := v.Value()
+		if err != nil {
+			panic(err)
+		}
+		return value
+	}
+
+	value, err := driver.DefaultParameterConverter.ConvertValue(v)
+	if err != nil {
+		panic(fmt.Sprintf("fakeValue(%T): %v", v, err))
+	}
+	return value
+}
+
+func fakeErr(err error) fakeResult {
+	return fakeResult{err: err}
+}
+
+func fakeRowsAffected(n int64) fakeResult {
+	return fakeResult{rowsAffected: n}
+}
+
+func (db *fakeDB) Connect(ctx context.Context) (driver.Conn, error) {
+	return &fakeConn{db: db}, nil
+}
+
+func (db *fakeDB) Driver() driver.Driver {
+	return db
+}
+
+func (db *fakeDB) Open(name string) (driver.Conn, error) {
+	return &fakeConn{db: db}, nil
+}
+
+type fakeConn struct {
+	db *fakeDB
+	tx *fakeTx
+}
+
+type fakeTx struct {
+	conn      *fakeConn
+	committed bool
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("fakeDB: prepared statements are not supported")
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *fakeConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	c.tx = &fakeTx{conn: c}
+	return c.tx, nil
+}
+
+func (tx *fakeTx) Commit() error {
+	tx.committed = true
+	tx.conn.tx = nil
+	return nil
+}
+
+func (tx *fakeTx) Rollback() error {
+	tx.conn.tx = nil
+	return nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	result := c.db.run(query, args, c.tx)
+	if result.err != nil {
+		return nil, result.err
+	}
+	return &fakeDriverRows{rows: result.rows}, nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	result := c.db.run(query, args, c.tx)
+	if result.err != nil {
+		return nil, result.err
+	}
+	return driver.RowsAffected(result.rowsAffected), nil
+}
+
+type fakeDriverRows struct {
+	rows [][]driver.Value
+}
+
+func (r *fakeDriverRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return nil
+	}
+	columns := make([]string, len(r.rows[0]))
+	for i := range columns {
+		columns[i] = fmt.Sprintf("column%d", i+1)
+	}
+	return columns
+}
+
+func (r *fakeDriverRows) Close() error {
+	return nil
+}
+
+func (r *fakeDriverRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
@@ -1,28 +1,195 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"net/http"
-	"sort"
 	"time"
 
-	"github.com/glebson1988/chirpy/internal/auth"
 	"github.com/glebson1988/chirpy/internal/database"
 	"github.com/google/uuid"
 )
 
 type Chirp struct {
+	ID          uuid.UUID  `json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	Body        string     `json:"body"`
+	UserID      uuid.UUID  `json:"user_id"`
+	ParentID    *uuid.UUID `json:"parent_id,omitempty"`
+	RechirpOf   *uuid.UUID `json:"rechirp_of,omitempty"`
+	QuoteOf     *uuid.UUID `json:"quote_of,omitempty"`
+	QuotedChirp *Chirp     `json:"quoted_chirp,omitempty"`
+	Deleted     bool       `json:"deleted,omitempty"`
+	Mentions    []Mention  `json:"mentions"`
+	LikeCount   int64      `json:"like_count"`
+	LikedByMe   bool       `json:"liked_by_me"`
+}
+
+// ChirpThread is a chirp together with the replies posted under it.
+type ChirpThread struct {
+	Chirp
+	Replies []ChirpThread `json:"replies"`
+}
+
+type ChirpRevision struct {
 	ID        uuid.UUID `json:"id"`
 	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ChirpID   uuid.UUID `json:"chirp_id"`
 	Body      string    `json:"body"`
-	UserID    uuid.UUID `json:"user_id"`
+}
+
+func databaseChirpToChirp(chirp database.Chirp) Chirp {
+	response := Chirp{
+		ID:        chirp.ID,
+		CreatedAt: chirp.CreatedAt,
+		UpdatedAt: chirp.UpdatedAt,
+		Body:      chirp.Body,
+		UserID:    chirp.UserID,
+		Deleted:   chirp.DeletedAt.Valid,
+		Mentions:  []Mention{},
+	}
+	if chirp.ParentID.Valid {
+		parentID := chirp.ParentID.UUID
+		response.ParentID = &parentID
+	}
+	if chirp.RechirpOfID.Valid {
+		rechirpOf := chirp.RechirpOfID.UUID
+		response.RechirpOf = &rechirpOf
+	}
+	if chirp.QuoteOfID.Valid {
+		quoteOf := chirp.QuoteOfID.UUID
+		response.QuoteOf = &quoteOf
+	}
+	return response
+}
+
+// loadChirpDetails fills in the aggregate and viewer-specific fields of
+// chirps using one query per kind of detail, however many chirps there are.
+func (cfg *apiConfig) loadChirpDetails(ctx context.Context, chirps []Chirp, viewerID uuid.NullUUID) error {
+	if len(chirps) == 0 {
+		return nil
+	}
+
+	var quotedIDs []uuid.UUID
+	for _, chirp := range chirps {
+		if chirp.QuoteOf != nil {
+			quotedIDs = append(quotedIDs, *chirp.QuoteOf)
+		}
+	}
+
+	// Every chirp in the response, embedded quotes included, needs its
+	// like stats filled in.
+	all := make([]*Chirp, 0, len(chirps)+len(quotedIDs))
+	for i := range chirps {
+		all = append(all, &chirps[i])
+	}
+
+	if len(quotedIDs) > 0 {
+		quoted, err := cfg.db.GetChirpsByIds(ctx, quotedIDs)
+		if err != nil {
+			return err
+		}
+
+		byID := make(map[uuid.UUID]database.Chirp, len(quoted))
+		for _, chirp := range quoted {
+			byID[chirp.ID] = chirp
+		}
+		for i := range chirps {
+			if chirps[i].QuoteOf == nil {
+				continue
+			}
+			original, ok := byID[*chirps[i].QuoteOf]
+			if !ok {
+				continue
+			}
+			embedded := databaseChirpToChirp(original)
+			chirps[i].QuotedChirp = &embedded
+			all = append(all, &embedded)
+		}
+	}
+
+	ids := make([]uuid.UUID, 0, len(all))
+	for _, chirp := range all {
+		ids = append(ids, chirp.ID)
+	}
+
+	stats, err := cfg.db.GetChirpLikeStats(ctx, database.GetChirpLikeStatsParams{
+		ViewerID: viewerID,
+		ChirpIds: ids,
+	})
+	if err != nil {
+		return err
+	}
+
+	byChirp := make(map[uuid.UUID]database.GetChirpLikeStatsRow, len(stats))
+	for _, stat := range stats {
+		byChirp[stat.ChirpID] = stat
+	}
+	for _, chirp := range all {
+		stat := byChirp[chirp.ID]
+		chirp.LikeCount = stat.LikeCount
+		chirp.LikedByMe = stat.LikedByMe
+	}
+
+	mentions, err := cfg.db.GetChirpMentions(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	mentionsByChirp := make(map[uuid.UUID][]Mention)
+	for _, mention := range mentions {
+		mentionsByChirp[mention.ChirpID] = append(mentionsByChirp[mention.ChirpID], Mention{
+			UserID: mention.UserID,
+			Offset: mention.StartOffset,
+			Length: mention.Length,
+		})
+	}
+	for _, chirp := range all {
+		if chirpMentions, ok := mentionsByChirp[chirp.ID]; ok {
+			chirp.Mentions = chirpMentions
+		}
+	}
+
+	return nil
+}
+
+// getChirpTarget looks up the chirp that a reply, quote or rechirp should
+// point at. Rechirps stand in for their original, and tombstones can't be
+// targeted, so both missing and deleted chirps report sql.ErrNoRows.
+func (cfg *apiConfig) getChirpTarget(ctx context.Context, chirpID uuid.UUID) (database.Chirp, error) {
+	chirp, err := cfg.db.GetChirpById(ctx, chirpID)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+
+	if chirp.RechirpOfID.Valid {
+		chirp, err = cfg.db.GetChirpById(ctx, chirp.RechirpOfID.UUID)
+		if err != nil {
+			return database.Chirp{}, err
+		}
+	}
+
+	if chirp.DeletedAt.Valid {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+
+	return chirp, nil
+}
+
+// viewerID identifies the caller of a route behind middlewareOptionalAuth,
+// which is anonymous when no token was supplied.
+func viewerID(r *http.Request) uuid.NullUUID {
+	userID, ok := userIDFromContext(r.Context())
+	return uuid.NullUUID{UUID: userID, Valid: ok}
 }
 
 func (cfg *apiConfig) handlerCreateChirp(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
-		Body string `json:"body"`
+		Body      string     `json:"body"`
+		ParentID  *uuid.UUID `json:"parent_id"`
+		QuoteOfID *uuid.UUID `json:"quote_of_id"`
 	}
 
 	decoder := json.NewDecoder(r.Body)
@@ -32,16 +199,26 @@ func (cfg *apiConfig) handlerCreateChirp(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
+	userID, ok := userIDFromContext(r.Context())
+	if !ok {
 		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	userID, err := auth.ValidateJWT(token, cfg.tokenSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
-		return
+	if cfg.requireEmailVerification {
+		user, err := cfg.db.GetUserByID(r.Context(), userID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+			return
+		}
+		if !user.EmailVerifiedAt.Valid {
+			respondWithError(w, http.StatusForbidden, "Verify your email address before chirping")
+			return
+		}
 	}
 
 	if len(params.Body) > 140 {
@@ -49,63 +226,171 @@ func (cfg *apiConfig) handlerCreateChirp(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	var parentID uuid.NullUUID
+	if params.ParentID != nil {
+		parent, err := cfg.getChirpTarget(r.Context(), *params.ParentID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				respondWithError(w, http.StatusNotFound, "Parent chirp not found")
+				return
+			}
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+			return
+		}
+		parentID = uuid.NullUUID{UUID: parent.ID, Valid: true}
+	}
+
+	var quoteOfID uuid.NullUUID
+	if params.QuoteOfID != nil {
+		quoted, err := cfg.getChirpTarget(r.Context(), *params.QuoteOfID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				respondWithError(w, http.StatusNotFound, "Quoted chirp not found")
+				return
+			}
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+			return
+		}
+		quoteOfID = uuid.NullUUID{UUID: quoted.ID, Valid: true}
+	}
+
 	cleanedBody := cleanChirp(params.Body)
 
-	chirp, err := cfg.db.CreateChirp(r.Context(), database.CreateChirpParams{
-		Body:   cleanedBody,
-		UserID: userID,
-	})
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
 		return
 	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
 
-	respondWithJSON(w, http.StatusCreated, Chirp{
-		ID:        chirp.ID,
-		CreatedAt: chirp.CreatedAt,
-		UpdatedAt: chirp.UpdatedAt,
-		Body:      chirp.Body,
-		UserID:    chirp.UserID,
+	chirp, err := qtx.CreateChirp(r.Context(), database.CreateChirpParams{
+		Body:      cleanedBody,
+		UserID:    userID,
+		ParentID:  parentID,
+		QuoteOfID: quoteOfID,
 	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	if err := indexHashtags(r.Context(), qtx, chirp); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if err := indexMentions(r.Context(), qtx, chirp); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	response := []Chirp{databaseChirpToChirp(chirp)}
+	if err := cfg.loadChirpDetails(r.Context(), response, uuid.NullUUID{UUID: userID, Valid: true}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, response[0])
 }
 
 func (cfg *apiConfig) handlerListChirps(w http.ResponseWriter, r *http.Request) {
 	authorIDParam := r.URL.Query().Get("author_id")
-	sortParam := r.URL.Query().Get("sort")
-	var chirps []database.Chirp
-	var err error
-	if authorIDParam == "" {
-		chirps, err = cfg.db.GetChirps(r.Context())
-	} else {
-		authorID, parseErr := uuid.Parse(authorIDParam)
+	var authorID uuid.NullUUID
+	if authorIDParam != "" {
+		id, parseErr := uuid.Parse(authorIDParam)
 		if parseErr != nil {
 			respondWithError(w, http.StatusBadRequest, "Something went wrong")
 			return
 		}
-		chirps, err = cfg.db.GetChirpsByAuthor(r.Context(), authorID)
+		authorID = uuid.NullUUID{UUID: id, Valid: true}
 	}
+
+	cfg.respondWithChirpList(w, r, authorID, uuid.NullUUID{})
+}
+
+func (cfg *apiConfig) handlerListChirpReplies(w http.ResponseWriter, r *http.Request) {
+	chirpIDStr := r.PathValue("chirpID")
+	chirpID, err := uuid.Parse(chirpIDStr)
 	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Something went wrong")
+		return
+	}
+
+	if _, err := cfg.db.GetChirpById(r.Context(), chirpID); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Something went wrong")
+			return
+		}
 		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
 		return
 	}
 
-	response := make([]Chirp, 0, len(chirps))
-	for _, chirp := range chirps {
-		response = append(response, Chirp{
-			ID:        chirp.ID,
-			CreatedAt: chirp.CreatedAt,
-			UpdatedAt: chirp.UpdatedAt,
-			Body:      chirp.Body,
-			UserID:    chirp.UserID,
-		})
+	cfg.respondWithChirpList(w, r, uuid.NullUUID{}, uuid.NullUUID{UUID: chirpID, Valid: true})
+}
+
+// respondWithChirpList writes one page of live chirps, optionally narrowed
+// to a single author or to the direct replies of a chirp.
+func (cfg *apiConfig) respondWithChirpList(w http.ResponseWriter, r *http.Request, authorID, parentID uuid.NullUUID) {
+	sortParam := r.URL.Query().Get("sort")
+	if sortParam != "" && sortParam != "asc" && sortParam != "desc" {
+		respondWithError(w, http.StatusBadRequest, "Invalid sort")
+		return
+	}
+
+	limit, cursor, err := parsePageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid pagination parameters")
+		return
+	}
+
+	// A backward cursor walks towards the start of the list, so it reads in
+	// the opposite order and paginateChirps flips the rows back afterwards.
+	ascending := sortParam != "desc"
+	if cursor != nil && cursor.Backward {
+		ascending = !ascending
 	}
 
-	if sortParam == "desc" {
-		sort.Slice(response, func(i, j int) bool {
-			return response[i].CreatedAt.After(response[j].CreatedAt)
+	var chirps []database.Chirp
+	if ascending {
+		chirps, err = cfg.db.ListChirpsAfter(r.Context(), database.ListChirpsAfterParams{
+			AuthorID:        authorID,
+			ParentID:        parentID,
+			CursorCreatedAt: cursor.createdAt(),
+			CursorID:        cursor.id(),
+			RowLimit:        int32(limit + 1),
 		})
+	} else {
+		chirps, err = cfg.db.ListChirpsBefore(r.Context(), database.ListChirpsBeforeParams{
+			AuthorID:        authorID,
+			ParentID:        parentID,
+			CursorCreatedAt: cursor.createdAt(),
+			CursorID:        cursor.id(),
+			RowLimit:        int32(limit + 1),
+		})
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
 	}
 
+	page := paginateChirps(chirps, limit, cursor)
+
+	response := make([]Chirp, 0, len(page.chirps))
+	for _, chirp := range page.chirps {
+		response = append(response, databaseChirpToChirp(chirp))
+	}
+
+	if err := cfg.loadChirpDetails(r.Context(), response, viewerID(r)); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	setPaginationLinks(w, r, page.next, page.prev)
 	respondWithJSON(w, http.StatusOK, response)
 }
 
@@ -127,16 +412,188 @@ func (cfg *apiConfig) handlerGetChirp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, Chirp{
-		ID:        chirp.ID,
-		CreatedAt: chirp.CreatedAt,
-		UpdatedAt: chirp.UpdatedAt,
+	response := []Chirp{databaseChirpToChirp(chirp)}
+	if err := cfg.loadChirpDetails(r.Context(), response, viewerID(r)); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response[0])
+}
+
+func (cfg *apiConfig) handlerGetChirpThread(w http.ResponseWriter, r *http.Request) {
+	chirpIDStr := r.PathValue("chirpID")
+	chirpID, err := uuid.Parse(chirpIDStr)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Something went wrong")
+		return
+	}
+
+	rows, err := cfg.db.GetChirpThread(r.Context(), chirpID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if len(rows) == 0 {
+		respondWithError(w, http.StatusNotFound, "Something went wrong")
+		return
+	}
+
+	chirps := make([]Chirp, 0, len(rows))
+	for _, row := range rows {
+		chirps = append(chirps, databaseChirpToChirp(database.Chirp(row)))
+	}
+
+	if err := cfg.loadChirpDetails(r.Context(), chirps, viewerID(r)); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, buildChirpThread(chirps))
+}
+
+// buildChirpThread nests a conversation returned by GetChirpThread. The rows
+// are ordered by creation time, so the first one is always the root and
+// every reply arrives after its parent.
+func buildChirpThread(chirps []Chirp) ChirpThread {
+	children := make(map[uuid.UUID][]Chirp)
+	for _, chirp := range chirps[1:] {
+		if chirp.ParentID != nil {
+			children[*chirp.ParentID] = append(children[*chirp.ParentID], chirp)
+		}
+	}
+
+	var build func(chirp Chirp) ChirpThread
+	build = func(chirp Chirp) ChirpThread {
+		node := ChirpThread{
+			Chirp:   chirp,
+			Replies: make([]ChirpThread, 0, len(children[chirp.ID])),
+		}
+		for _, reply := range children[chirp.ID] {
+			node.Replies = append(node.Replies, build(reply))
+		}
+		return node
+	}
+
+	return build(chirps[0])
+}
+
+func (cfg *apiConfig) handlerUpdateChirp(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Body string `json:"body"`
+	}
+
+	chirpIDStr := r.PathValue("chirpID")
+	chirpID, err := uuid.Parse(chirpIDStr)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Something went wrong")
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	var params parameters
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Something went wrong")
+		return
+	}
+
+	userID, ok := userIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if len(params.Body) > 140 {
+		respondWithError(w, http.StatusBadRequest, "Chirp is too long")
+		return
+	}
+
+	cleanedBody := cleanChirp(params.Body)
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	// Lock the row so concurrent edits can't both archive the same body.
+	chirp, err := qtx.GetChirpByIdForUpdate(r.Context(), chirpID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Something went wrong")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	if chirp.DeletedAt.Valid {
+		respondWithError(w, http.StatusNotFound, "Something went wrong")
+		return
+	}
+
+	if chirp.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	if chirp.RechirpOfID.Valid {
+		respondWithError(w, http.StatusBadRequest, "Rechirps can't be edited")
+		return
+	}
+
+	if err := qtx.CreateChirpRevision(r.Context(), database.CreateChirpRevisionParams{
+		CreatedAt: chirp.UpdatedAt,
+		ChirpID:   chirp.ID,
 		Body:      chirp.Body,
-		UserID:    chirp.UserID,
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	updated, err := qtx.UpdateChirpBody(r.Context(), database.UpdateChirpBodyParams{
+		ID:   chirp.ID,
+		Body: cleanedBody,
 	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	if err := qtx.DeleteChirpHashtags(r.Context(), updated.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if err := indexHashtags(r.Context(), qtx, updated); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if err := qtx.DeleteChirpMentions(r.Context(), updated.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if err := indexMentions(r.Context(), qtx, updated); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	response := []Chirp{databaseChirpToChirp(updated)}
+	if err := cfg.loadChirpDetails(r.Context(), response, uuid.NullUUID{UUID: userID, Valid: true}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response[0])
 }
 
-func (cfg *apiConfig) handlerDeleteChirp(w http.ResponseWriter, r *http.Request) {
+func (cfg *apiConfig) handlerListChirpRevisions(w http.ResponseWriter, r *http.Request) {
 	chirpIDStr := r.PathValue("chirpID")
 	chirpID, err := uuid.Parse(chirpIDStr)
 	if err != nil {
@@ -144,19 +601,59 @@ func (cfg *apiConfig) handlerDeleteChirp(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
+	if _, err := cfg.db.GetChirpById(r.Context(), chirpID); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Something went wrong")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	revisions, err := cfg.db.ListChirpRevisions(r.Context(), chirpID)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
 		return
 	}
 
-	userID, err := auth.ValidateJWT(token, cfg.tokenSecret)
+	response := make([]ChirpRevision, 0, len(revisions))
+	for _, revision := range revisions {
+		response = append(response, ChirpRevision{
+			ID:        revision.ID,
+			CreatedAt: revision.CreatedAt,
+			ChirpID:   revision.ChirpID,
+			Body:      revision.Body,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (cfg *apiConfig) handlerDeleteChirp(w http.ResponseWriter, r *http.Request) {
+	chirpIDStr := r.PathValue("chirpID")
+	chirpID, err := uuid.Parse(chirpIDStr)
 	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Something went wrong")
+		return
+	}
+
+	userID, ok := userIDFromContext(r.Context())
+	if !ok {
 		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	chirp, err := cfg.db.GetChirpById(r.Context(), chirpID)
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	// Holding the row lock blocks replies from being attached while we
+	// decide between a hard delete and a tombstone.
+	chirp, err := qtx.GetChirpByIdForUpdate(r.Context(), chirpID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			respondWithError(w, http.StatusNotFound, "Something went wrong")
@@ -166,15 +663,53 @@ func (cfg *apiConfig) handlerDeleteChirp(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if chirp.DeletedAt.Valid {
+		respondWithError(w, http.StatusNotFound, "Something went wrong")
+		return
+	}
+
 	if chirp.UserID != userID {
 		respondWithError(w, http.StatusForbidden, "Forbidden")
 		return
 	}
 
-	if err := cfg.db.DeleteChirp(r.Context(), chirpID); err != nil {
+	if err := deleteChirp(r.Context(), qtx, chirp.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// deleteChirp removes a chirp, leaving a tombstone in its place when other
+// chirps reply to or quote it so those keep pointing at something. Plain
+// rechirps have nothing of their own to show and go away with the original.
+func deleteChirp(ctx context.Context, q *database.Queries, chirpID uuid.UUID) error {
+	isReferenced, err := q.ChirpIsReferenced(ctx, chirpID)
+	if err != nil {
+		return err
+	}
+
+	if !isReferenced {
+		return q.DeleteChirp(ctx, chirpID)
+	}
+
+	if err := q.DeleteRechirpsOf(ctx, uuid.NullUUID{UUID: chirpID, Valid: true}); err != nil {
+		return err
+	}
+	if err := q.DeleteChirpRevisions(ctx, chirpID); err != nil {
+		return err
+	}
+	if err := q.DeleteChirpHashtags(ctx, chirpID); err != nil {
+		return err
+	}
+	if err := q.DeleteChirpMentions(ctx, chirpID); err != nil {
+		return err
+	}
+	return q.TombstoneChirp(ctx, chirpID)
+}
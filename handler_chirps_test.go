@@ -0,0 +1,196 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebson1988/chirpy/internal/auth"
+	"github.com/glebson1988/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestBuildChirpThread(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	root := database.Chirp{ID: uuid.New(), CreatedAt: start, Body: "root"}
+	reply := database.Chirp{
+		ID:        uuid.New(),
+		CreatedAt: start.Add(time.Minute),
+		ParentID:  uuid.NullUUID{UUID: root.ID, Valid: true},
+		DeletedAt: sql.NullTime{Time: start.Add(time.Hour), Valid: true},
+	}
+	nested := database.Chirp{
+		ID:        uuid.New(),
+		CreatedAt: start.Add(2 * time.Minute),
+		Body:      "nested",
+		ParentID:  uuid.NullUUID{UUID: reply.ID, Valid: true},
+	}
+	sibling := database.Chirp{
+		ID:        uuid.New(),
+		CreatedAt: start.Add(3 * time.Minute),
+		Body:      "sibling",
+		ParentID:  uuid.NullUUID{UUID: root.ID, Valid: true},
+	}
+
+	chirps := []Chirp{
+		databaseChirpToChirp(root),
+		databaseChirpToChirp(reply),
+		databaseChirpToChirp(nested),
+		databaseChirpToChirp(sibling),
+	}
+
+	thread := buildChirpThread(chirps)
+
+	if thread.ID != root.ID {
+		t.Fatalf("buildChirpThread() root = %v, want %v", thread.ID, root.ID)
+	}
+	if len(thread.Replies) != 2 {
+		t.Fatalf("buildChirpThread() root has %d replies, want 2", len(thread.Replies))
+	}
+	if thread.Replies[0].ID != reply.ID || thread.Replies[1].ID != sibling.ID {
+		t.Fatalf("buildChirpThread() replies out of order")
+	}
+	if !thread.Replies[0].Deleted {
+		t.Fatalf("buildChirpThread() expected tombstoned reply to be marked deleted")
+	}
+	if len(thread.Replies[0].Replies) != 1 || thread.Replies[0].Replies[0].ID != nested.ID {
+		t.Fatalf("buildChirpThread() expected nested reply under the tombstone")
+	}
+	if thread.Replies[1].Replies == nil || len(thread.Replies[1].Replies) != 0 {
+		t.Fatalf("buildChirpThread() leaf replies should be an empty list")
+	}
+}
+
+func TestHandlerUpdateChirp(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	authorID := uuid.New()
+	chirp := database.Chirp{
+		ID:        uuid.New(),
+		CreatedAt: start,
+		UpdatedAt: start.Add(time.Minute),
+		Body:      "first draft",
+		UserID:    authorID,
+	}
+	deleted := chirp
+	deleted.DeletedAt = sql.NullTime{Time: start.Add(time.Hour), Valid: true}
+
+	tests := []struct {
+		name         string
+		callerID     uuid.UUID
+		stored       *database.Chirp
+		wantStatus   int
+		wantRevision bool
+	}{
+		{name: "author", callerID: authorID, stored: &chirp, wantStatus: http.StatusOK, wantRevision: true},
+		{name: "not the author", callerID: uuid.New(), stored: &chirp, wantStatus: http.StatusForbidden},
+		{name: "deleted", callerID: authorID, stored: &deleted, wantStatus: http.StatusNotFound},
+		{name: "missing", callerID: authorID, wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, db := newFakeDBConfig(t)
+			if tt.stored != nil {
+				stored := *tt.stored
+				db.on("GetChirpByIdForUpdate", func(args []driver.Value) fakeResult {
+					return fakeRows(stored)
+				})
+			}
+			db.on("UpdateChirpBody", func(args []driver.Value) fakeResult {
+				updated := chirp
+				updated.Body = "second draft"
+				updated.UpdatedAt = start.Add(2 * time.Minute)
+				return fakeRows(updated)
+			})
+
+			req := httptest.NewRequest(http.MethodPut, "/api/chirps/"+chirp.ID.String(), strings.NewReader(`{"body": "second draft"}`))
+			req.SetPathValue("chirpID", chirp.ID.String())
+			req = requestAs(req, principal{UserID: tt.callerID, Role: auth.RoleUser})
+			rec := httptest.NewRecorder()
+
+			cfg.handlerUpdateChirp(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("handlerUpdateChirp() status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+
+			revisions := db.committedCalls("CreateChirpRevision")
+			if !tt.wantRevision {
+				if len(revisions) != 0 {
+					t.Fatalf("handlerUpdateChirp() wrote %d revisions, want 0", len(revisions))
+				}
+				return
+			}
+			if len(revisions) != 1 {
+				t.Fatalf("handlerUpdateChirp() wrote %d revisions, want 1", len(revisions))
+			}
+			// The revision keeps the body being replaced, dated when it was
+			// last written.
+			args := revisions[0].args
+			if args[0] != chirp.UpdatedAt || args[1] != chirp.ID.String() || args[2] != chirp.Body {
+				t.Fatalf("CreateChirpRevision args = %v, want [%v %v %q]", args, chirp.UpdatedAt, chirp.ID, chirp.Body)
+			}
+
+			var got Chirp
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if got.Body != "second draft" {
+				t.Fatalf("handlerUpdateChirp() body = %q, want %q", got.Body, "second draft")
+			}
+		})
+	}
+}
+
+func TestHandlerListChirpRevisions(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	chirp := database.Chirp{ID: uuid.New(), CreatedAt: start, UpdatedAt: start.Add(2 * time.Hour), Body: "third"}
+	first := database.ChirpRevision{ID: uuid.New(), CreatedAt: start, ChirpID: chirp.ID, Body: "first"}
+	second := database.ChirpRevision{ID: uuid.New(), CreatedAt: start.Add(time.Hour), ChirpID: chirp.ID, Body: "second"}
+
+	cfg, db := newFakeDBConfig(t)
+	db.on("GetChirpById", func(args []driver.Value) fakeResult {
+		return fakeRows(chirp)
+	})
+	db.on("ListChirpRevisions", func(args []driver.Value) fakeResult {
+		return fakeRows(first, second)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/chirps/"+chirp.ID.String()+"/revisions", nil)
+	req.SetPathValue("chirpID", chirp.ID.String())
+	rec := httptest.NewRecorder()
+
+	cfg.handlerListChirpRevisions(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("handlerListChirpRevisions() status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	var got []ChirpRevision
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(got) != 2 || got[0].Body != "first" || got[1].Body != "second" {
+		t.Fatalf("handlerListChirpRevisions() = %+v, want first then second", got)
+	}
+}
+
+func TestHandlerListChirpRevisionsMissingChirp(t *testing.T) {
+	cfg, _ := newFakeDBConfig(t)
+	chirpID := uuid.New()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/chirps/"+chirpID.String()+"/revisions", nil)
+	req.SetPathValue("chirpID", chirpID.String())
+	rec := httptest.NewRecorder()
+
+	cfg.handlerListChirpRevisions(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("handlerListChirpRevisions() status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
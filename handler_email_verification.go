@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/glebson1988/chirpy/internal/auth"
+	"github.com/glebson1988/chirpy/internal/database"
+	"github.com/glebson1988/chirpy/internal/mailer"
+	"github.com/google/uuid"
+)
+
+const (
+	emailVerificationPurpose = "chirpy-email-verification"
+	emailVerificationTTL     = 24 * time.Hour
+)
+
+// sendVerificationEmail mails the user a single-use token for their
+// current email address. The token is a signed JWT whose jti matches a row
+// in email_verification_tokens, which is marked used on redemption.
+func (cfg *apiConfig) sendVerificationEmail(ctx context.Context, user database.User) error {
+	tokenID := uuid.New()
+	if err := cfg.db.CreateEmailVerificationToken(ctx, database.CreateEmailVerificationTokenParams{
+		ID:        tokenID,
+		UserID:    user.ID,
+		Email:     user.Email,
+		ExpiresAt: time.Now().UTC().Add(emailVerificationTTL),
+	}); err != nil {
+		return err
+	}
+
+	token, err := auth.MakePurposeJWT(user.ID, tokenID, emailVerificationPurpose, cfg.tokenKeys, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	return cfg.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your Chirpy email address",
+		Body: fmt.Sprintf(
+			"Confirm this address by sending the token below to %s/api/users/verify-email within 24 hours:\n\n%s\n\nIf you didn't sign up for Chirpy, you can ignore this email.",
+			cfg.baseURL, token,
+		),
+	})
+}
+
+func (cfg *apiConfig) handlerVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token string `json:"token"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	var params parameters
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Something went wrong")
+		return
+	}
+
+	userID, tokenID, err := auth.ValidatePurposeJWT(params.Token, emailVerificationPurpose, cfg.tokenKeys)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired token")
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	email, err := qtx.UseEmailVerificationToken(r.Context(), database.UseEmailVerificationTokenParams{
+		ID:     tokenID,
+		UserID: userID,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusBadRequest, "Invalid or expired token")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	// The token is for the address it was mailed to; if the user has since
+	// changed their email it no longer proves anything.
+	verified, err := qtx.MarkEmailVerified(r.Context(), database.MarkEmailVerifiedParams{
+		ID:    userID,
+		Email: email,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if verified == 0 {
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired token")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerResendVerificationEmail(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Something went wrong")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	if user.EmailVerifiedAt.Valid {
+		respondWithError(w, http.StatusConflict, "Email is already verified")
+		return
+	}
+
+	if err := cfg.sendVerificationEmail(r.Context(), user); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebson1988/chirpy/internal/auth"
+	"github.com/glebson1988/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestHandlerVerifyEmailRejectsAccessToken(t *testing.T) {
+	cfg := &apiConfig{tokenKeys: newTestKeyring(t)}
+
+	token, err := auth.MakeJWT(uuid.New(), auth.RoleUser, auth.SessionScopes, cfg.tokenKeys, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/users/verify-email", strings.NewReader(`{"token": "`+token+`"}`))
+	rec := httptest.NewRecorder()
+
+	cfg.handlerVerifyEmail(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func verifyEmail(t *testing.T, cfg *apiConfig, token string) int {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/users/verify-email", strings.NewReader(`{"token": "`+token+`"}`))
+	rec := httptest.NewRecorder()
+
+	cfg.handlerVerifyEmail(rec, req)
+
+	return rec.Code
+}
+
+func TestHandlerVerifyEmailTokenIsSingleUse(t *testing.T) {
+	cfg, db := newFakeDBConfig(t)
+	userID := uuid.New()
+	tokenID := uuid.New()
+
+	used := false
+	db.on("UseEmailVerificationToken", func(args []driver.Value) fakeResult {
+		if used || args[0] != tokenID.String() {
+			return fakeResult{}
+		}
+		used = true
+		return fakeRows("user@example.com")
+	})
+	db.on("MarkEmailVerified", func(args []driver.Value) fakeResult {
+		return fakeRowsAffected(1)
+	})
+
+	token, err := auth.MakePurposeJWT(userID, tokenID, emailVerificationPurpose, cfg.tokenKeys, emailVerificationTTL)
+	if err != nil {
+		t.Fatalf("MakePurposeJWT: %v", err)
+	}
+
+	if status := verifyEmail(t, cfg, token); status != http.StatusNoContent {
+		t.Fatalf("first use status = %d, want %d", status, http.StatusNoContent)
+	}
+	if status := verifyEmail(t, cfg, token); status != http.StatusBadRequest {
+		t.Fatalf("second use status = %d, want %d", status, http.StatusBadRequest)
+	}
+	if calls := db.committedCalls("MarkEmailVerified"); len(calls) != 1 {
+		t.Fatalf("MarkEmailVerified committed %d times, want 1", len(calls))
+	}
+}
+
+func TestHandlerVerifyEmailAfterEmailChange(t *testing.T) {
+	cfg, db := newFakeDBConfig(t)
+	userID := uuid.New()
+	tokenID := uuid.New()
+
+	db.on("UseEmailVerificationToken", func(args []driver.Value) fakeResult {
+		return fakeRows("old@example.com")
+	})
+	// The user's email is no longer the one the token was mailed to.
+	db.on("MarkEmailVerified", func(args []driver.Value) fakeResult {
+		if args[1] != "new@example.com" {
+			return fakeRowsAffected(0)
+		}
+		return fakeRowsAffected(1)
+	})
+
+	token, err := auth.MakePurposeJWT(userID, tokenID, emailVerificationPurpose, cfg.tokenKeys, emailVerificationTTL)
+	if err != nil {
+		t.Fatalf("MakePurposeJWT: %v", err)
+	}
+
+	if status := verifyEmail(t, cfg, token); status != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", status, http.StatusBadRequest)
+	}
+	// Nothing, including using up the token, is kept.
+	if calls := db.committedCalls("UseEmailVerificationToken"); len(calls) != 0 {
+		t.Fatalf("UseEmailVerificationToken committed %d times, want 0", len(calls))
+	}
+}
+
+func TestHandlerCreateChirpRequiresVerifiedEmail(t *testing.T) {
+	cfg, db := newFakeDBConfig(t)
+	cfg.requireEmailVerification = true
+	user := database.User{ID: uuid.New(), Email: "user@example.com", Role: auth.RoleUser}
+
+	db.on("GetUserByID", func(args []driver.Value) fakeResult {
+		return fakeRows(user)
+	})
+
+	send := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/api/chirps", strings.NewReader(`{"body": "hello"}`))
+		req = requestAs(req, principal{UserID: user.ID, Role: auth.RoleUser})
+		rec := httptest.NewRecorder()
+
+		cfg.handlerCreateChirp(rec, req)
+
+		return rec.Code
+	}
+
+	if status := send(); status != http.StatusForbidden {
+		t.Fatalf("unverified status = %d, want %d", status, http.StatusForbidden)
+	}
+	if calls := db.calls("CreateChirp"); len(calls) != 0 {
+		t.Fatalf("CreateChirp ran %d times for an unverified user, want 0", len(calls))
+	}
+
+	user.EmailVerifiedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	if status := send(); status == http.StatusForbidden {
+		t.Fatalf("verified user got %d", status)
+	}
+	if calls := db.calls("CreateChirp"); len(calls) != 1 {
+		t.Fatalf("CreateChirp ran %d times for a verified user, want 1", len(calls))
+	}
+}
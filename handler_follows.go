@@ -0,0 +1,223 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/glebson1988/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+type Follow struct {
+	UserID    uuid.UUID `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (cfg *apiConfig) handlerFollowUser(w http.ResponseWriter, r *http.Request) {
+	userIDStr := r.PathValue("userID")
+	followeeID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Something went wrong")
+		return
+	}
+
+	userID, ok := userIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if followeeID == userID {
+		respondWithError(w, http.StatusBadRequest, "You can't follow yourself")
+		return
+	}
+
+	if _, err := cfg.db.GetUserByID(r.Context(), followeeID); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Something went wrong")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	if err := cfg.db.FollowUser(r.Context(), database.FollowUserParams{
+		FollowerID: userID,
+		FolloweeID: followeeID,
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerUnfollowUser(w http.ResponseWriter, r *http.Request) {
+	userIDStr := r.PathValue("userID")
+	followeeID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Something went wrong")
+		return
+	}
+
+	userID, ok := userIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if err := cfg.db.UnfollowUser(r.Context(), database.UnfollowUserParams{
+		FollowerID: userID,
+		FolloweeID: followeeID,
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerListFollowers pages through a user's followers, most recent
+// first.
+func (cfg *apiConfig) handlerListFollowers(w http.ResponseWriter, r *http.Request) {
+	userIDStr := r.PathValue("userID")
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Something went wrong")
+		return
+	}
+
+	limit, cursor, err := parsePageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid pagination parameters")
+		return
+	}
+
+	followers, err := cfg.db.ListFollowers(r.Context(), database.ListFollowersParams{
+		FolloweeID:      userID,
+		CursorCreatedAt: cursor.createdAt(),
+		CursorID:        cursor.id(),
+		RowLimit:        int32(limit + 1),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	var next *pageCursor
+	if len(followers) > limit {
+		followers = followers[:limit]
+		last := followers[len(followers)-1]
+		next = &pageCursor{CreatedAt: last.CreatedAt, ID: last.FollowerID}
+	}
+
+	response := make([]Follow, 0, len(followers))
+	for _, follower := range followers {
+		response = append(response, Follow{
+			UserID:    follower.FollowerID,
+			CreatedAt: follower.CreatedAt,
+		})
+	}
+
+	setPaginationLinks(w, r, next, nil)
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// handlerListFollowing pages through the users someone follows, most
+// recently followed first.
+func (cfg *apiConfig) handlerListFollowing(w http.ResponseWriter, r *http.Request) {
+	userIDStr := r.PathValue("userID")
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Something went wrong")
+		return
+	}
+
+	limit, cursor, err := parsePageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid pagination parameters")
+		return
+	}
+
+	following, err := cfg.db.ListFollowing(r.Context(), database.ListFollowingParams{
+		FollowerID:      userID,
+		CursorCreatedAt: cursor.createdAt(),
+		CursorID:        cursor.id(),
+		RowLimit:        int32(limit + 1),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	var next *pageCursor
+	if len(following) > limit {
+		following = following[:limit]
+		last := following[len(following)-1]
+		next = &pageCursor{CreatedAt: last.CreatedAt, ID: last.FolloweeID}
+	}
+
+	response := make([]Follow, 0, len(following))
+	for _, followee := range following {
+		response = append(response, Follow{
+			UserID:    followee.FolloweeID,
+			CreatedAt: followee.CreatedAt,
+		})
+	}
+
+	setPaginationLinks(w, r, next, nil)
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (cfg *apiConfig) handlerTimeline(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	limit, cursor, err := parsePageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid pagination parameters")
+		return
+	}
+
+	// The timeline is newest first; a backward cursor reads towards newer
+	// chirps and paginateChirps puts them back in display order.
+	var chirps []database.Chirp
+	if cursor != nil && cursor.Backward {
+		chirps, err = cfg.db.ListTimelineAfter(r.Context(), database.ListTimelineAfterParams{
+			UserID:          userID,
+			CursorCreatedAt: cursor.createdAt(),
+			CursorID:        cursor.id(),
+			RowLimit:        int32(limit + 1),
+		})
+	} else {
+		chirps, err = cfg.db.ListTimelineBefore(r.Context(), database.ListTimelineBeforeParams{
+			UserID:          userID,
+			CursorCreatedAt: cursor.createdAt(),
+			CursorID:        cursor.id(),
+			RowLimit:        int32(limit + 1),
+		})
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	page := paginateChirps(chirps, limit, cursor)
+
+	response := make([]Chirp, 0, len(page.chirps))
+	for _, chirp := range page.chirps {
+		response = append(response, databaseChirpToChirp(chirp))
+	}
+
+	if err := cfg.loadChirpDetails(r.Context(), response, uuid.NullUUID{UUID: userID, Valid: true}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	setPaginationLinks(w, r, page.next, page.prev)
+	respondWithJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/glebson1988/chirpy/internal/auth"
+	"github.com/glebson1988/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+var linkPattern = regexp.MustCompile(`<([^>]*)>; rel="([a-z]+)"`)
+
+// linkTarget returns the URL of the Link header with the given rel, or ""
+// if there is none.
+func linkTarget(t *testing.T, header http.Header, rel string) string {
+	t.Helper()
+	for _, link := range header.Values("Link") {
+		match := linkPattern.FindStringSubmatch(link)
+		if match == nil {
+			t.Fatalf("malformed Link header %q", link)
+		}
+		if match[2] == rel {
+			return match[1]
+		}
+	}
+	return ""
+}
+
+func TestHandlerFollowUserRejectsSelf(t *testing.T) {
+	cfg, db := newFakeDBConfig(t)
+	userID := uuid.New()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/users/"+userID.String()+"/follow", nil)
+	req.SetPathValue("userID", userID.String())
+	req = requestAs(req, principal{UserID: userID, Role: auth.RoleUser})
+	rec := httptest.NewRecorder()
+
+	cfg.handlerFollowUser(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("handlerFollowUser() status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if calls := db.calls("FollowUser"); len(calls) != 0 {
+		t.Fatalf("handlerFollowUser() ran FollowUser %d times, want 0", len(calls))
+	}
+}
+
+func TestHandlerFollowUserIsIdempotent(t *testing.T) {
+	cfg, db := newFakeDBConfig(t)
+	followerID := uuid.New()
+	followee := database.User{ID: uuid.New(), Email: "followee@example.com", Role: auth.RoleUser}
+
+	db.on("GetUserByID", func(args []driver.Value) fakeResult {
+		return fakeRows(followee)
+	})
+	// The second insert hits ON CONFLICT DO NOTHING.
+	inserted := false
+	db.on("FollowUser", func(args []driver.Value) fakeResult {
+		if inserted {
+			return fakeRowsAffected(0)
+		}
+		inserted = true
+		return fakeRowsAffected(1)
+	})
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/api/users/"+followee.ID.String()+"/follow", nil)
+		req.SetPathValue("userID", followee.ID.String())
+		req = requestAs(req, principal{UserID: followerID, Role: auth.RoleUser})
+		rec := httptest.NewRecorder()
+
+		cfg.handlerFollowUser(rec, req)
+
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("handlerFollowUser() call %d status = %d, want %d", i+1, rec.Code, http.StatusNoContent)
+		}
+	}
+}
+
+func TestHandlerUnfollowUserIsIdempotent(t *testing.T) {
+	cfg, db := newFakeDBConfig(t)
+	followerID := uuid.New()
+	followeeID := uuid.New()
+
+	removed := false
+	db.on("UnfollowUser", func(args []driver.Value) fakeResult {
+		if removed {
+			return fakeRowsAffected(0)
+		}
+		removed = true
+		return fakeRowsAffected(1)
+	})
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodDelete, "/api/users/"+followeeID.String()+"/follow", nil)
+		req.SetPathValue("userID", followeeID.String())
+		req = requestAs(req, principal{UserID: followerID, Role: auth.RoleUser})
+		rec := httptest.NewRecorder()
+
+		cfg.handlerUnfollowUser(rec, req)
+
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("handlerUnfollowUser() call %d status = %d, want %d", i+1, rec.Code, http.StatusNoContent)
+		}
+	}
+}
+
+// fakeKeysetQuery answers a (created_at, id) keyset query over rows, which
+// must be sorted oldest first. args[cursorArg] and args[cursorArg+1] are
+// the cursor and args[cursorArg+2] the row limit, as in the sqlc queries.
+func fakeKeysetQuery(rows []database.Chirp, cursorArg int, newestFirst bool) func(args []driver.Value) fakeResult {
+	return func(args []driver.Value) fakeResult {
+		limit := int(args[cursorArg+2].(int64))
+		var selected []any
+		for i := range rows {
+			row := rows[i]
+			if newestFirst {
+				row = rows[len(rows)-1-i]
+			}
+			if cursorAt, ok := args[cursorArg].(time.Time); ok {
+				if newestFirst && !row.CreatedAt.Before(cursorAt) {
+					continue
+				}
+				if !newestFirst && !row.CreatedAt.After(cursorAt) {
+					continue
+				}
+			}
+			if len(selected) == limit {
+				break
+			}
+			selected = append(selected, row)
+		}
+		return fakeRows(selected...)
+	}
+}
+
+func TestHandlerTimelinePagination(t *testing.T) {
+	cfg, db := newFakeDBConfig(t)
+	userID := uuid.New()
+	chirps := makeChirps(5)
+
+	db.on("ListTimelineBefore", fakeKeysetQuery(chirps, 1, true))
+	db.on("ListTimelineAfter", fakeKeysetQuery(chirps, 1, false))
+
+	get := func(target string) (*httptest.ResponseRecorder, []Chirp) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req = requestAs(req, principal{UserID: userID, Role: auth.RoleUser})
+		rec := httptest.NewRecorder()
+
+		cfg.handlerTimeline(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("handlerTimeline(%s) status = %d, want %d", target, rec.Code, http.StatusOK)
+		}
+		var page []Chirp
+		if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		return rec, page
+	}
+	wantPage := func(page []Chirp, want ...database.Chirp) {
+		t.Helper()
+		if len(page) != len(want) {
+			t.Fatalf("page has %d chirps, want %d", len(page), len(want))
+		}
+		for i := range want {
+			if page[i].ID != want[i].ID {
+				t.Fatalf("page[%d] = %v, want %v", i, page[i].ID, want[i].ID)
+			}
+		}
+	}
+
+	rec, page := get("/api/timeline?limit=2")
+	wantPage(page, chirps[4], chirps[3])
+	if prev := linkTarget(t, rec.Header(), "prev"); prev != "" {
+		t.Fatalf("first page has a prev link %q", prev)
+	}
+
+	rec, page = get(linkTarget(t, rec.Header(), "next"))
+	wantPage(page, chirps[2], chirps[1])
+	prevFromSecond := linkTarget(t, rec.Header(), "prev")
+
+	rec, page = get(linkTarget(t, rec.Header(), "next"))
+	wantPage(page, chirps[0])
+	if next := linkTarget(t, rec.Header(), "next"); next != "" {
+		t.Fatalf("last page has a next link %q", next)
+	}
+
+	// Going back from the last page returns the middle page in display
+	// order, read with ListTimelineAfter.
+	_, page = get(linkTarget(t, rec.Header(), "prev"))
+	wantPage(page, chirps[2], chirps[1])
+	if len(db.calls("ListTimelineAfter")) != 1 {
+		t.Fatalf("prev link didn't read with ListTimelineAfter")
+	}
+
+	_, page = get(prevFromSecond)
+	wantPage(page, chirps[4], chirps[3])
+}
+
+func TestHandlerListFollowersPagination(t *testing.T) {
+	cfg, db := newFakeDBConfig(t)
+	userID := uuid.New()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	followers := []database.ListFollowersRow{
+		{FollowerID: uuid.New(), CreatedAt: start.Add(3 * time.Minute)},
+		{FollowerID: uuid.New(), CreatedAt: start.Add(2 * time.Minute)},
+		{FollowerID: uuid.New(), CreatedAt: start.Add(time.Minute)},
+	}
+
+	db.on("ListFollowers", func(args []driver.Value) fakeResult {
+		limit := int(args[3].(int64))
+		var rows []any
+		for _, follower := range followers {
+			if cursorAt, ok := args[1].(time.Time); ok && !follower.CreatedAt.Before(cursorAt) {
+				continue
+			}
+			if len(rows) < limit {
+				rows = append(rows, follower)
+			}
+		}
+		return fakeRows(rows...)
+	})
+
+	target := "/api/users/" + userID.String() + "/followers?limit=2"
+	var got []Follow
+	for pages := 0; target != ""; pages++ {
+		if pages == 3 {
+			t.Fatalf("handlerListFollowers() kept returning next links")
+		}
+
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.SetPathValue("userID", userID.String())
+		rec := httptest.NewRecorder()
+
+		cfg.handlerListFollowers(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("handlerListFollowers() status = %d, want %d", rec.Code, http.StatusOK)
+		}
+		var page []Follow
+		if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		got = append(got, page...)
+
+		target = linkTarget(t, rec.Header(), "next")
+		if target != "" {
+			next, err := url.Parse(target)
+			if err != nil {
+				t.Fatalf("parse next link: %v", err)
+			}
+			if next.Query().Get("limit") != "2" {
+				t.Fatalf("next link %q dropped the limit", target)
+			}
+		}
+	}
+
+	if len(got) != len(followers) {
+		t.Fatalf("handlerListFollowers() returned %d followers over all pages, want %d", len(got), len(followers))
+	}
+	for i, follower := range followers {
+		if got[i].UserID != follower.FollowerID {
+			t.Fatalf("follower %d = %v, want %v", i, got[i].UserID, follower.FollowerID)
+		}
+	}
+}
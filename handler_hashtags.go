@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/glebson1988/chirpy/internal/database"
+)
+
+const (
+	defaultTrendingWindow = 24 * time.Hour
+	maxTrendingWindow     = 7 * 24 * time.Hour
+	maxHashtagLength      = 100
+)
+
+// A hashtag starts at the beginning of the body or after a character that
+// can't be part of a word, so "mail#tag" and "&#39;" don't count.
+var hashtagPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_&])#([\p{L}\p{N}_]+)`)
+
+type HashtagUsage struct {
+	Tag  string `json:"tag"`
+	Uses int64  `json:"uses"`
+}
+
+// extractHashtags returns the distinct, lowercased hashtags in body in the
+// order they first appear. Tags made up only of digits and underscores
+// are ignored.
+func extractHashtags(body string) []string {
+	seen := make(map[string]struct{})
+	var tags []string
+	for _, match := range hashtagPattern.FindAllStringSubmatch(body, -1) {
+		tag := strings.ToLower(match[1])
+		if len(tag) > maxHashtagLength || strings.IndexFunc(tag, unicode.IsLetter) < 0 {
+			continue
+		}
+		if _, ok := seen[tag]; ok {
+			continue
+		}
+		seen[tag] = struct{}{}
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// indexHashtags records the hashtags in a chirp's body. Callers replacing a
+// body should clear the old tags with DeleteChirpHashtags first.
+func indexHashtags(ctx context.Context, q *database.Queries, chirp database.Chirp) error {
+	tags := extractHashtags(chirp.Body)
+	if len(tags) == 0 {
+		return nil
+	}
+
+	return q.CreateChirpHashtags(ctx, database.CreateChirpHashtagsParams{
+		ChirpID:   chirp.ID,
+		Tags:      tags,
+		CreatedAt: chirp.CreatedAt,
+	})
+}
+
+func (cfg *apiConfig) handlerListHashtagChirps(w http.ResponseWriter, r *http.Request) {
+	tag := strings.ToLower(strings.TrimPrefix(r.PathValue("tag"), "#"))
+	if tag == "" {
+		respondWithError(w, http.StatusBadRequest, "Something went wrong")
+		return
+	}
+
+	limit, cursor, err := parsePageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid pagination parameters")
+		return
+	}
+
+	// Newest first, like the timeline.
+	var chirps []database.Chirp
+	if cursor != nil && cursor.Backward {
+		chirps, err = cfg.db.ListHashtagChirpsAfter(r.Context(), database.ListHashtagChirpsAfterParams{
+			Tag:             tag,
+			CursorCreatedAt: cursor.createdAt(),
+			CursorID:        cursor.id(),
+			RowLimit:        int32(limit + 1),
+		})
+	} else {
+		chirps, err = cfg.db.ListHashtagChirpsBefore(r.Context(), database.ListHashtagChirpsBeforeParams{
+			Tag:             tag,
+			CursorCreatedAt: cursor.createdAt(),
+			CursorID:        cursor.id(),
+			RowLimit:        int32(limit + 1),
+		})
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	page := paginateChirps(chirps, limit, cursor)
+
+	response := make([]Chirp, 0, len(page.chirps))
+	for _, chirp := range page.chirps {
+		response = append(response, databaseChirpToChirp(chirp))
+	}
+
+	if err := cfg.loadChirpDetails(r.Context(), response, viewerID(r)); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	setPaginationLinks(w, r, page.next, page.prev)
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (cfg *apiConfig) handlerTrendingHashtags(w http.ResponseWriter, r *http.Request) {
+	window := defaultTrendingWindow
+	if windowParam := r.URL.Query().Get("window"); windowParam != "" {
+		parsed, err := time.ParseDuration(windowParam)
+		if err != nil || parsed <= 0 || parsed > maxTrendingWindow {
+			respondWithError(w, http.StatusBadRequest, "Invalid window")
+			return
+		}
+		window = parsed
+	}
+
+	limit := 10
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		parsed, err := strconv.Atoi(limitParam)
+		if err != nil || parsed < 1 || parsed > maxPageLimit {
+			respondWithError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		limit = parsed
+	}
+
+	trending, err := cfg.db.ListTrendingHashtags(r.Context(), database.ListTrendingHashtagsParams{
+		Since:    time.Now().UTC().Add(-window),
+		RowLimit: int32(limit),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	response := make([]HashtagUsage, 0, len(trending))
+	for _, usage := range trending {
+		response = append(response, HashtagUsage{
+			Tag:  usage.Tag,
+			Uses: usage.Uses,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
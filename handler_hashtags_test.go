@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestExtractHashtags(t *testing.T) {
+	tests := []struct {
+		body string
+		want []string
+	}{
+		{body: "no tags here", want: nil},
+		{body: "#Go is fun, #go is #great", want: []string{"go", "great"}},
+		{body: "mail#nottag and (#paren) #end.", want: []string{"paren", "end"}},
+		{body: "#2024 #year_2024 #_", want: []string{"year_2024"}},
+		{body: "&#39; #café", want: []string{"café"}},
+	}
+
+	for _, tt := range tests {
+		got := extractHashtags(tt.body)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("extractHashtags(%q) got %v, want %v", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestHandlerTrendingHashtagsInvalidWindow(t *testing.T) {
+	cfg := &apiConfig{}
+
+	for _, window := range []string{"soon", "-1h", "720h"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/hashtags/trending?window="+window, nil)
+		rec := httptest.NewRecorder()
+
+		cfg.handlerTrendingHashtags(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("handlerTrendingHashtags(window=%s) status = %d, want %d", window, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebson1988/chirpy/internal/auth"
+	"github.com/glebson1988/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// fakeLikes keeps the likes table for the fake driver, keyed by user and
+// chirp ID, so LikeChirp, UnlikeChirp and GetChirpLikeStats agree.
+type fakeLikes map[[2]string]bool
+
+func (likes fakeLikes) register(db *fakeDB) {
+	db.on("LikeChirp", func(args []driver.Value) fakeResult {
+		likes[[2]string{args[0].(string), args[1].(string)}] = true
+		return fakeResult{}
+	})
+	db.on("UnlikeChirp", func(args []driver.Value) fakeResult {
+		delete(likes, [2]string{args[0].(string), args[1].(string)})
+		return fakeResult{}
+	})
+	db.on("GetChirpLikeStats", func(args []driver.Value) fakeResult {
+		stats := map[string]*database.GetChirpLikeStatsRow{}
+		for like := range likes {
+			if !strings.Contains(args[1].(string), like[1]) {
+				continue
+			}
+			stat, ok := stats[like[1]]
+			if !ok {
+				stat = &database.GetChirpLikeStatsRow{ChirpID: uuid.MustParse(like[1])}
+				stats[like[1]] = stat
+			}
+			stat.LikeCount++
+			stat.LikedByMe = stat.LikedByMe || args[0] == like[0]
+		}
+		rows := make([]any, 0, len(stats))
+		for _, stat := range stats {
+			rows = append(rows, *stat)
+		}
+		return fakeRows(rows...)
+	})
+}
+
+func likeRequest(method string, chirpID, userID uuid.UUID) *http.Request {
+	req := httptest.NewRequest(method, "/api/chirps/"+chirpID.String()+"/likes", nil)
+	req.SetPathValue("chirpID", chirpID.String())
+	return requestAs(req, principal{UserID: userID, Role: auth.RoleUser})
+}
+
+func TestHandlerLikeChirp(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	original := database.Chirp{ID: uuid.New(), CreatedAt: start, UpdatedAt: start, Body: "original", UserID: uuid.New()}
+	userID := uuid.New()
+
+	cfg, db := newFakeDBConfig(t)
+	db.on("GetChirpById", chirpsByID(original))
+	likes := fakeLikes{}
+	likes.register(db)
+	liked := [2]string{userID.String(), original.ID.String()}
+
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		cfg.handlerLikeChirp(rec, likeRequest(http.MethodPost, original.ID, userID))
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("like #%d status = %d, want %d", i+1, rec.Code, http.StatusNoContent)
+		}
+	}
+	if len(likes) != 1 || !likes[liked] {
+		t.Fatalf("likes after liking twice = %v, want only %v", likes, liked)
+	}
+
+	rec := httptest.NewRecorder()
+	cfg.handlerUnlikeChirp(rec, likeRequest(http.MethodDelete, original.ID, userID))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("unlike status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	if len(likes) != 0 {
+		t.Fatalf("likes after unliking = %v, want none", likes)
+	}
+
+	missing := uuid.New()
+	rec = httptest.NewRecorder()
+	cfg.handlerLikeChirp(rec, likeRequest(http.MethodPost, missing, userID))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("like of a missing chirp status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	rec = httptest.NewRecorder()
+	cfg.handlerUnlikeChirp(rec, likeRequest(http.MethodDelete, missing, userID))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("unlike of a missing chirp status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+}
+
+func TestLoadChirpDetailsLikes(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	popular := database.Chirp{ID: uuid.New(), CreatedAt: start, UpdatedAt: start, Body: "popular", UserID: uuid.New()}
+	quiet := database.Chirp{ID: uuid.New(), CreatedAt: start, UpdatedAt: start, Body: "quiet", UserID: uuid.New()}
+	viewer, other := uuid.New(), uuid.New()
+
+	cfg, db := newFakeDBConfig(t)
+	likes := fakeLikes{
+		{viewer.String(), popular.ID.String()}: true,
+		{other.String(), popular.ID.String()}:  true,
+	}
+	likes.register(db)
+
+	tests := []struct {
+		name          string
+		viewer        uuid.NullUUID
+		wantLikedByMe bool
+	}{
+		{name: "viewer liked it", viewer: uuid.NullUUID{UUID: viewer, Valid: true}, wantLikedByMe: true},
+		{name: "viewer didn't like it", viewer: uuid.NullUUID{UUID: uuid.New(), Valid: true}},
+		{name: "anonymous", viewer: uuid.NullUUID{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chirps := []Chirp{databaseChirpToChirp(popular), databaseChirpToChirp(quiet)}
+			if err := cfg.loadChirpDetails(context.Background(), chirps, tt.viewer); err != nil {
+				t.Fatalf("loadChirpDetails() error = %v", err)
+			}
+
+			if chirps[0].LikeCount != 2 || chirps[0].LikedByMe != tt.wantLikedByMe {
+				t.Fatalf("popular chirp like_count = %d, liked_by_me = %v, want 2, %v", chirps[0].LikeCount, chirps[0].LikedByMe, tt.wantLikedByMe)
+			}
+			if chirps[1].LikeCount != 0 || chirps[1].LikedByMe {
+				t.Fatalf("quiet chirp like_count = %d, liked_by_me = %v, want 0, false", chirps[1].LikeCount, chirps[1].LikedByMe)
+			}
+		})
+	}
+}
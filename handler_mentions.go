@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/glebson1988/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+var (
+	handlePattern = regexp.MustCompile(`^[a-z0-9_]{3,30}$`)
+	// Like hashtags, a mention can't start in the middle of a word, which
+	// keeps email addresses from being read as mentions.
+	mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_@])@([A-Za-z0-9_]{3,30})\b`)
+)
+
+// Mention points at the "@handle" text inside a chirp body. Offset and
+// length are counted in Unicode code points.
+type Mention struct {
+	UserID uuid.UUID `json:"user_id"`
+	Offset int32     `json:"offset"`
+	Length int32     `json:"length"`
+}
+
+type mentionToken struct {
+	handle string
+	offset int32
+	length int32
+}
+
+// normalizeHandle lowercases a handle and reports whether it is valid.
+func normalizeHandle(handle string) (string, bool) {
+	handle = strings.ToLower(strings.TrimPrefix(handle, "@"))
+	return handle, handlePattern.MatchString(handle)
+}
+
+// extractMentions finds every @handle token in body, in order.
+func extractMentions(body string) []mentionToken {
+	var tokens []mentionToken
+	for _, loc := range mentionPattern.FindAllStringSubmatchIndex(body, -1) {
+		at := loc[2] - 1
+		handle := body[loc[2]:loc[3]]
+		tokens = append(tokens, mentionToken{
+			handle: strings.ToLower(handle),
+			offset: int32(utf8.RuneCountInString(body[:at])),
+			length: int32(utf8.RuneCountInString(handle) + 1),
+		})
+	}
+	return tokens
+}
+
+// indexMentions resolves the @handles in a chirp's body to users and records
+// them. Handles that don't belong to anyone are left as plain text. Callers
+// replacing a body should clear the old mentions with DeleteChirpMentions
+// first.
+func indexMentions(ctx context.Context, q *database.Queries, chirp database.Chirp) error {
+	tokens := extractMentions(chirp.Body)
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	handles := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		handles = append(handles, token.handle)
+	}
+
+	users, err := q.GetUsersByHandles(ctx, handles)
+	if err != nil {
+		return err
+	}
+
+	userIDs := make(map[string]uuid.UUID, len(users))
+	for _, user := range users {
+		userIDs[user.Handle.String] = user.ID
+	}
+
+	params := database.CreateChirpMentionsParams{ChirpID: chirp.ID}
+	for _, token := range tokens {
+		userID, ok := userIDs[token.handle]
+		if !ok {
+			continue
+		}
+		params.UserIds = append(params.UserIds, userID)
+		params.StartOffsets = append(params.StartOffsets, token.offset)
+		params.Lengths = append(params.Lengths, token.length)
+	}
+	if len(params.UserIds) == 0 {
+		return nil
+	}
+
+	return q.CreateChirpMentions(ctx, params)
+}
+
+func (cfg *apiConfig) handlerListMentions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	limit, cursor, err := parsePageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid pagination parameters")
+		return
+	}
+
+	// Newest first, like the timeline.
+	var chirps []database.Chirp
+	if cursor != nil && cursor.Backward {
+		chirps, err = cfg.db.ListMentionChirpsAfter(r.Context(), database.ListMentionChirpsAfterParams{
+			UserID:          userID,
+			CursorCreatedAt: cursor.createdAt(),
+			CursorID:        cursor.id(),
+			RowLimit:        int32(limit + 1),
+		})
+	} else {
+		chirps, err = cfg.db.ListMentionChirpsBefore(r.Context(), database.ListMentionChirpsBeforeParams{
+			UserID:          userID,
+			CursorCreatedAt: cursor.createdAt(),
+			CursorID:        cursor.id(),
+			RowLimit:        int32(limit + 1),
+		})
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	page := paginateChirps(chirps, limit, cursor)
+
+	response := make([]Chirp, 0, len(page.chirps))
+	for _, chirp := range page.chirps {
+		response = append(response, databaseChirpToChirp(chirp))
+	}
+
+	if err := cfg.loadChirpDetails(r.Context(), response, uuid.NullUUID{UUID: userID, Valid: true}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	setPaginationLinks(w, r, page.next, page.prev)
+	respondWithJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractMentions(t *testing.T) {
+	tests := []struct {
+		body string
+		want []mentionToken
+	}{
+		{body: "no mentions here", want: nil},
+		{body: "hi @Alice and @bob_2!", want: []mentionToken{
+			{handle: "alice", offset: 3, length: 6},
+			{handle: "bob_2", offset: 14, length: 6},
+		}},
+		{body: "mail me at me@example.com or @@ab", want: nil},
+		{body: "@thisisaveryveryverylonghandle_x", want: nil},
+		{body: "café @carol", want: []mentionToken{
+			{handle: "carol", offset: 5, length: 6},
+		}},
+	}
+
+	for _, tt := range tests {
+		got := extractMentions(tt.body)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("extractMentions(%q) got %v, want %v", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeHandle(t *testing.T) {
+	tests := []struct {
+		handle string
+		want   string
+		ok     bool
+	}{
+		{handle: "Gopher", want: "gopher", ok: true},
+		{handle: "@go_pher", want: "go_pher", ok: true},
+		{handle: "go", want: "go", ok: false},
+		{handle: "go-pher", want: "go-pher", ok: false},
+	}
+
+	for _, tt := range tests {
+		got, ok := normalizeHandle(tt.handle)
+		if got != tt.want || ok != tt.ok {
+			t.Fatalf("normalizeHandle(%q) got (%q, %v), want (%q, %v)", tt.handle, got, ok, tt.want, tt.ok)
+		}
+	}
+}
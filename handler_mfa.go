@@ -0,0 +1,401 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/glebson1988/chirpy/internal/auth"
+	"github.com/glebson1988/chirpy/internal/database"
+)
+
+const (
+	mfaChallengePurpose = "chirpy-mfa-challenge"
+	mfaChallengeTTL     = 5 * time.Minute
+	totpIssuer          = "Chirpy"
+	recoveryCodeCount   = 10
+
+	// maxMFAChallengeAttempts is how many codes can be tried against one
+	// challenge; after that the user has to log in with their password
+	// again. maxMFAUserAttempts caps codes tried across all of a user's
+	// unfinished challenges from the last mfaLockoutWindow.
+	maxMFAChallengeAttempts = 5
+	maxMFAUserAttempts      = 10
+	mfaLockoutWindow        = 15 * time.Minute
+)
+
+// MFAChallenge is what handlerLogin returns instead of tokens when the user
+// has two-factor authentication turned on.
+type MFAChallenge struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+
+type TOTPEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// handlerEnrollTOTP gives the caller a new TOTP secret. Two-factor
+// authentication isn't turned on until a code from it is confirmed with
+// handlerConfirmTOTP.
+func (cfg *apiConfig) handlerEnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Something went wrong")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	if user.TotpEnabledAt.Valid {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	if err := cfg.db.SetTOTPSecret(r.Context(), database.SetTOTPSecretParams{
+		ID:         user.ID,
+		TotpSecret: sql.NullString{String: secret, Valid: true},
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, TOTPEnrollment{
+		Secret:     secret,
+		OTPAuthURI: auth.TOTPURI(secret, totpIssuer, user.Email),
+	})
+}
+
+// handlerConfirmTOTP turns on two-factor authentication once the caller
+// proves their authenticator works, and hands out a fresh set of recovery
+// codes. The codes are only ever shown here; the database keeps digests.
+func (cfg *apiConfig) handlerConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Code string `json:"code"`
+	}
+
+	userID, ok := userIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	var params parameters
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Something went wrong")
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Something went wrong")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	if user.TotpEnabledAt.Valid {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+	if !user.TotpSecret.Valid {
+		respondWithError(w, http.StatusBadRequest, "Start enrolment first")
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(user.TotpSecret.String, params.Code, time.Now())
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Invalid code")
+		return
+	}
+
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	hashes := make([]string, 0, len(codes))
+	for _, code := range codes {
+		hashes = append(hashes, auth.HashToken(auth.NormalizeRecoveryCode(code)))
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	if err := qtx.EnableTOTP(r.Context(), database.EnableTOTPParams{
+		ID:               user.ID,
+		TotpLastUsedStep: sql.NullInt64{Int64: step, Valid: true},
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	if err := qtx.DeleteRecoveryCodes(r.Context(), user.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	if err := qtx.CreateRecoveryCodes(r.Context(), database.CreateRecoveryCodesParams{
+		UserID:     user.ID,
+		CodeHashes: hashes,
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, RecoveryCodes{RecoveryCodes: codes})
+}
+
+// handlerDisableTOTP turns two-factor authentication off. It needs the
+// password and a current TOTP code or unused recovery code.
+func (cfg *apiConfig) handlerDisableTOTP(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	userID, ok := userIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	var params parameters
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Something went wrong")
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Something went wrong")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	if params.Code == "" && params.RecoveryCode == "" {
+		respondWithError(w, http.StatusBadRequest, "A code or recovery code is required")
+		return
+	}
+
+	if !user.TotpEnabledAt.Valid || !user.TotpSecret.Valid {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication isn't enabled")
+		return
+	}
+
+	ok, err = auth.CheckPasswordHash(params.Password, user.HashedPassword)
+	if err != nil || !ok {
+		respondWithError(w, http.StatusUnauthorized, "Incorrect password")
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	// A stolen password and session aren't enough to remove the second
+	// factor; the caller has to prove they still hold it.
+	ok, err = useSecondFactor(r.Context(), qtx, user, params.Code, params.RecoveryCode)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Invalid code")
+		return
+	}
+
+	if err := qtx.DisableTOTP(r.Context(), user.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	if err := qtx.DeleteRecoveryCodes(r.Context(), user.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerLoginMFA finishes a login started with handlerLogin. It takes the
+// challenge token plus either a TOTP code or an unused recovery code. Each
+// challenge works once and only allows a few tries.
+func (cfg *apiConfig) handlerLoginMFA(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	var params parameters
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Something went wrong")
+		return
+	}
+
+	if params.Code == "" && params.RecoveryCode == "" {
+		respondWithError(w, http.StatusBadRequest, "A code or recovery code is required")
+		return
+	}
+
+	userID, challengeID, err := auth.ValidatePurposeJWT(params.MFAToken, mfaChallengePurpose, cfg.tokenKeys)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	recentAttempts, err := cfg.db.CountRecentMFAAttempts(r.Context(), database.CountRecentMFAAttemptsParams{
+		UserID:    userID,
+		CreatedAt: time.Now().UTC().Add(-mfaLockoutWindow),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if recentAttempts >= maxMFAUserAttempts {
+		respondWithError(w, http.StatusTooManyRequests, "Too many attempts, try again later")
+		return
+	}
+
+	// The attempt is counted before the code is checked, and outside the
+	// transaction below, so failed and concurrent tries all count.
+	if _, err := cfg.db.ClaimMFAChallengeAttempt(r.Context(), database.ClaimMFAChallengeAttemptParams{
+		ID:          challengeID,
+		UserID:      userID,
+		MaxAttempts: maxMFAChallengeAttempts,
+	}); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusUnauthorized, "Challenge is expired, used or out of attempts; log in again")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	if !user.TotpEnabledAt.Valid || !user.TotpSecret.Valid {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	verified, err := useSecondFactor(r.Context(), qtx, user, params.Code, params.RecoveryCode)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if !verified {
+		respondWithError(w, http.StatusUnauthorized, "Invalid code")
+		return
+	}
+
+	// If another request finished this challenge first, the code stays
+	// unused.
+	consumed, err := qtx.UseMFAChallenge(r.Context(), challengeID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if consumed == 0 {
+		respondWithError(w, http.StatusUnauthorized, "Challenge is expired, used or out of attempts; log in again")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	cfg.respondWithLogin(w, r, user)
+}
+
+// useSecondFactor redeems a TOTP code for user, or a recovery code if code
+// is empty. It reports false if the code is wrong or was already used.
+func useSecondFactor(ctx context.Context, q *database.Queries, user database.User, code, recoveryCode string) (bool, error) {
+	if code != "" {
+		step, ok := auth.ValidateTOTP(user.TotpSecret.String, code, time.Now())
+		if !ok {
+			return false, nil
+		}
+
+		// A code can only be used once, even within its own time window.
+		used, err := q.UseTOTPStep(ctx, database.UseTOTPStepParams{
+			ID:               user.ID,
+			TotpLastUsedStep: sql.NullInt64{Int64: step, Valid: true},
+		})
+		return used == 1, err
+	}
+
+	used, err := q.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{
+		UserID:   user.ID,
+		CodeHash: auth.HashToken(auth.NormalizeRecoveryCode(recoveryCode)),
+	})
+	return used == 1, err
+}
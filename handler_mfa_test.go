@@ -0,0 +1,261 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebson1988/chirpy/internal/auth"
+	"github.com/glebson1988/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestHandlerLoginMFARejectsAccessToken(t *testing.T) {
+	cfg := &apiConfig{tokenKeys: newTestKeyring(t)}
+
+	token, err := auth.MakeJWT(uuid.New(), auth.RoleUser, auth.SessionScopes, cfg.tokenKeys, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/login/mfa", strings.NewReader(`{"mfa_token": "`+token+`", "code": "123456"}`))
+	rec := httptest.NewRecorder()
+
+	cfg.handlerLoginMFA(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestHandlerLoginMFARequiresCode(t *testing.T) {
+	cfg := &apiConfig{tokenKeys: newTestKeyring(t)}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/login/mfa", strings.NewReader(`{"mfa_token": "x"}`))
+	rec := httptest.NewRecorder()
+
+	cfg.handlerLoginMFA(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+// fakeMFAChallenge answers the mfa_challenges queries for a single
+// challenge row.
+type fakeMFAChallenge struct {
+	id       uuid.UUID
+	attempts int64
+	used     bool
+}
+
+func (c *fakeMFAChallenge) register(db *fakeDB) {
+	db.on("CountRecentMFAAttempts", func(args []driver.Value) fakeResult {
+		return fakeRows(int64(0))
+	})
+	db.on("ClaimMFAChallengeAttempt", func(args []driver.Value) fakeResult {
+		if args[0] != c.id.String() || c.used || c.attempts >= args[2].(int64) {
+			return fakeResult{}
+		}
+		c.attempts++
+		return fakeRows(c.attempts)
+	})
+	db.on("UseMFAChallenge", func(args []driver.Value) fakeResult {
+		if args[0] != c.id.String() || c.used {
+			return fakeRowsAffected(0)
+		}
+		c.used = true
+		return fakeRowsAffected(1)
+	})
+}
+
+func newMFATestUser(t *testing.T) database.User {
+	t.Helper()
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret: %v", err)
+	}
+	return database.User{
+		ID:            uuid.New(),
+		Email:         "mfa@example.com",
+		Role:          auth.RoleUser,
+		TotpSecret:    sql.NullString{String: secret, Valid: true},
+		TotpEnabledAt: sql.NullTime{Time: time.Now(), Valid: true},
+	}
+}
+
+func loginMFA(t *testing.T, cfg *apiConfig, token, code string) int {
+	t.Helper()
+	body := `{"mfa_token": "` + token + `", "code": "` + code + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/login/mfa", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+
+	cfg.handlerLoginMFA(rec, req)
+
+	return rec.Code
+}
+
+func TestHandlerLoginMFAConsumesChallenge(t *testing.T) {
+	cfg, db := newFakeDBConfig(t)
+	user := newMFATestUser(t)
+	challenge := &fakeMFAChallenge{id: uuid.New()}
+	challenge.register(db)
+	db.on("GetUserByID", func(args []driver.Value) fakeResult {
+		return fakeRows(user)
+	})
+	db.on("UseTOTPStep", func(args []driver.Value) fakeResult {
+		return fakeRowsAffected(1)
+	})
+
+	token, err := auth.MakePurposeJWT(user.ID, challenge.id, mfaChallengePurpose, cfg.tokenKeys, mfaChallengeTTL)
+	if err != nil {
+		t.Fatalf("MakePurposeJWT: %v", err)
+	}
+	code, err := auth.TOTPCode(user.TotpSecret.String, time.Now())
+	if err != nil {
+		t.Fatalf("TOTPCode: %v", err)
+	}
+
+	if status := loginMFA(t, cfg, token, code); status != http.StatusOK {
+		t.Fatalf("first login status = %d, want %d", status, http.StatusOK)
+	}
+	if calls := db.committedCalls("UseMFAChallenge"); len(calls) != 1 {
+		t.Fatalf("UseMFAChallenge committed %d times, want 1", len(calls))
+	}
+
+	// The same challenge token can't log in twice, even with a valid code.
+	if status := loginMFA(t, cfg, token, code); status != http.StatusUnauthorized {
+		t.Fatalf("replayed login status = %d, want %d", status, http.StatusUnauthorized)
+	}
+	if calls := db.calls("CreateSession"); len(calls) != 1 {
+		t.Fatalf("CreateSession ran %d times, want 1", len(calls))
+	}
+}
+
+func TestHandlerLoginMFALocksChallengeAfterFailedAttempts(t *testing.T) {
+	cfg, db := newFakeDBConfig(t)
+	user := newMFATestUser(t)
+	challenge := &fakeMFAChallenge{id: uuid.New()}
+	challenge.register(db)
+	db.on("GetUserByID", func(args []driver.Value) fakeResult {
+		return fakeRows(user)
+	})
+	db.on("UseTOTPStep", func(args []driver.Value) fakeResult {
+		return fakeRowsAffected(1)
+	})
+
+	token, err := auth.MakePurposeJWT(user.ID, challenge.id, mfaChallengePurpose, cfg.tokenKeys, mfaChallengeTTL)
+	if err != nil {
+		t.Fatalf("MakePurposeJWT: %v", err)
+	}
+	code, err := auth.TOTPCode(user.TotpSecret.String, time.Now())
+	if err != nil {
+		t.Fatalf("TOTPCode: %v", err)
+	}
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+
+	for i := 0; i < maxMFAChallengeAttempts; i++ {
+		if status := loginMFA(t, cfg, token, wrong); status != http.StatusUnauthorized {
+			t.Fatalf("wrong code %d status = %d, want %d", i+1, status, http.StatusUnauthorized)
+		}
+	}
+
+	if status := loginMFA(t, cfg, token, code); status != http.StatusUnauthorized {
+		t.Fatalf("correct code after %d misses status = %d, want %d", maxMFAChallengeAttempts, status, http.StatusUnauthorized)
+	}
+	if calls := db.calls("CreateSession"); len(calls) != 0 {
+		t.Fatalf("CreateSession ran %d times on a locked challenge, want 0", len(calls))
+	}
+}
+
+func TestHandlerLoginMFALocksUserAfterFailedAttempts(t *testing.T) {
+	cfg, db := newFakeDBConfig(t)
+	user := newMFATestUser(t)
+	db.on("CountRecentMFAAttempts", func(args []driver.Value) fakeResult {
+		return fakeRows(int64(maxMFAUserAttempts))
+	})
+
+	token, err := auth.MakePurposeJWT(user.ID, uuid.New(), mfaChallengePurpose, cfg.tokenKeys, mfaChallengeTTL)
+	if err != nil {
+		t.Fatalf("MakePurposeJWT: %v", err)
+	}
+
+	if status := loginMFA(t, cfg, token, "123456"); status != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", status, http.StatusTooManyRequests)
+	}
+	if calls := db.calls("ClaimMFAChallengeAttempt"); len(calls) != 0 {
+		t.Fatalf("ClaimMFAChallengeAttempt ran %d times for a locked out user, want 0", len(calls))
+	}
+}
+
+func TestHandlerDisableTOTP(t *testing.T) {
+	user := newMFATestUser(t)
+	hashedPassword, err := auth.HashPassword("hunter2")
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	user.HashedPassword = hashedPassword
+	code, err := auth.TOTPCode(user.TotpSecret.String, time.Now())
+	if err != nil {
+		t.Fatalf("TOTPCode: %v", err)
+	}
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{name: "totp code", body: `{"password": "hunter2", "code": "` + code + `"}`, wantStatus: http.StatusNoContent},
+		{name: "recovery code", body: `{"password": "hunter2", "recovery_code": "abcde-fghij"}`, wantStatus: http.StatusNoContent},
+		{name: "password only", body: `{"password": "hunter2"}`, wantStatus: http.StatusBadRequest},
+		{name: "wrong code", body: `{"password": "hunter2", "code": "` + wrong + `"}`, wantStatus: http.StatusUnauthorized},
+		{name: "used recovery code", body: `{"password": "hunter2", "recovery_code": "used0-codes"}`, wantStatus: http.StatusUnauthorized},
+		{name: "wrong password", body: `{"password": "nope", "code": "` + code + `"}`, wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, db := newFakeDBConfig(t)
+			db.on("GetUserByID", func(args []driver.Value) fakeResult {
+				return fakeRows(user)
+			})
+			db.on("UseTOTPStep", func(args []driver.Value) fakeResult {
+				return fakeRowsAffected(1)
+			})
+			db.on("UseRecoveryCode", func(args []driver.Value) fakeResult {
+				if args[1] != auth.HashToken(auth.NormalizeRecoveryCode("abcde-fghij")) {
+					return fakeRowsAffected(0)
+				}
+				return fakeRowsAffected(1)
+			})
+
+			req := httptest.NewRequest(http.MethodDelete, "/api/mfa/totp", strings.NewReader(tt.body))
+			req = requestAs(req, principal{UserID: user.ID, Role: auth.RoleUser})
+			rec := httptest.NewRecorder()
+
+			cfg.handlerDisableTOTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("handlerDisableTOTP() status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			wantDisabled := 0
+			if tt.wantStatus == http.StatusNoContent {
+				wantDisabled = 1
+			}
+			if calls := db.committedCalls("DisableTOTP"); len(calls) != wantDisabled {
+				t.Fatalf("handlerDisableTOTP() committed DisableTOTP %d times, want %d", len(calls), wantDisabled)
+			}
+		})
+	}
+}
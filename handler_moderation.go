@@ -0,0 +1,357 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/glebson1988/chirpy/internal/auth"
+	"github.com/glebson1988/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	moderationActionSuspend     = "suspend"
+	moderationActionBan         = "ban"
+	moderationActionReinstate   = "reinstate"
+	moderationActionRemoveChirp = "remove_chirp"
+
+	maxModerationReasonLength = 500
+	maxSuspensionHours        = 365 * 24
+)
+
+// ModerationAction is an entry in the moderation log.
+type ModerationAction struct {
+	ID             uuid.UUID  `json:"id"`
+	ModeratorID    *uuid.UUID `json:"moderator_id"`
+	Action         string     `json:"action"`
+	TargetUserID   *uuid.UUID `json:"target_user_id"`
+	TargetChirpID  *uuid.UUID `json:"target_chirp_id"`
+	Reason         string     `json:"reason"`
+	SuspendedUntil *time.Time `json:"suspended_until"`
+	ReportID       *uuid.UUID `json:"report_id"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+func databaseModerationActionToModerationAction(action database.ModerationAction) ModerationAction {
+	response := ModerationAction{
+		ID:        action.ID,
+		Action:    action.Action,
+		Reason:    action.Reason,
+		CreatedAt: action.CreatedAt,
+	}
+	if action.ModeratorID.Valid {
+		response.ModeratorID = &action.ModeratorID.UUID
+	}
+	if action.TargetUserID.Valid {
+		response.TargetUserID = &action.TargetUserID.UUID
+	}
+	if action.TargetChirpID.Valid {
+		response.TargetChirpID = &action.TargetChirpID.UUID
+	}
+	if action.SuspendedUntil.Valid {
+		response.SuspendedUntil = &action.SuspendedUntil.Time
+	}
+	if action.ReportID.Valid {
+		response.ReportID = &action.ReportID.UUID
+	}
+	return response
+}
+
+// suspensionMessage explains why a user can't sign in right now, or
+// returns "" if they can.
+func suspensionMessage(bannedAt, suspendedUntil sql.NullTime) string {
+	if bannedAt.Valid {
+		return "Account is banned"
+	}
+	if suspendedUntil.Valid && suspendedUntil.Time.After(time.Now().UTC()) {
+		return "Account is suspended until " + suspendedUntil.Time.Format(time.RFC3339)
+	}
+	return ""
+}
+
+// parseModerationReason checks the reason every moderation action must be
+// logged with.
+func parseModerationReason(reason string) (string, bool) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" || utf8.RuneCountInString(reason) > maxModerationReasonLength {
+		return "", false
+	}
+	return reason, true
+}
+
+// moderateUser applies action to the user named in the path, if the caller
+// outranks them, and logs it. Suspending and banning also sign the user
+// out everywhere.
+func (cfg *apiConfig) moderateUser(w http.ResponseWriter, r *http.Request, action, reason string, suspendedUntil sql.NullTime) {
+	targetID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	p, ok := principalFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	target, err := cfg.db.GetUserByID(r.Context(), targetID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "User not found")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	// Moderators can't act on each other, or on themselves; only an admin
+	// can act on a moderator.
+	if auth.HasRole(target.Role, p.Role) {
+		respondWithError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	switch action {
+	case moderationActionSuspend:
+		err = qtx.SuspendUser(r.Context(), database.SuspendUserParams{ID: target.ID, SuspendedUntil: suspendedUntil})
+	case moderationActionBan:
+		err = qtx.BanUser(r.Context(), target.ID)
+	case moderationActionReinstate:
+		err = qtx.ReinstateUser(r.Context(), target.ID)
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	if action != moderationActionReinstate {
+		if err := qtx.RevokeUserRefreshTokens(r.Context(), target.ID); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+			return
+		}
+	}
+
+	logged, err := qtx.CreateModerationAction(r.Context(), database.CreateModerationActionParams{
+		ModeratorID:    uuid.NullUUID{UUID: p.UserID, Valid: true},
+		Action:         action,
+		TargetUserID:   uuid.NullUUID{UUID: target.ID, Valid: true},
+		Reason:         reason,
+		SuspendedUntil: suspendedUntil,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, databaseModerationActionToModerationAction(logged))
+}
+
+func (cfg *apiConfig) handlerSuspendUser(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		DurationHours int    `json:"duration_hours"`
+		Reason        string `json:"reason"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	var params parameters
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Something went wrong")
+		return
+	}
+
+	if params.DurationHours < 1 || params.DurationHours > maxSuspensionHours {
+		respondWithError(w, http.StatusBadRequest, "duration_hours must be between 1 and 8760")
+		return
+	}
+	reason, ok := parseModerationReason(params.Reason)
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Reason must be 1-500 characters")
+		return
+	}
+
+	suspendedUntil := sql.NullTime{
+		Time:  time.Now().UTC().Add(time.Duration(params.DurationHours) * time.Hour),
+		Valid: true,
+	}
+	cfg.moderateUser(w, r, moderationActionSuspend, reason, suspendedUntil)
+}
+
+func (cfg *apiConfig) handlerBanUser(w http.ResponseWriter, r *http.Request) {
+	reason, ok := decodeModerationReason(w, r)
+	if !ok {
+		return
+	}
+
+	cfg.moderateUser(w, r, moderationActionBan, reason, sql.NullTime{})
+}
+
+// handlerReinstateUser lifts a suspension or ban. Tokens revoked when it
+// was imposed stay revoked; the user logs in again.
+func (cfg *apiConfig) handlerReinstateUser(w http.ResponseWriter, r *http.Request) {
+	reason, ok := decodeModerationReason(w, r)
+	if !ok {
+		return
+	}
+
+	cfg.moderateUser(w, r, moderationActionReinstate, reason, sql.NullTime{})
+}
+
+// handlerRemoveChirp deletes any chirp, whoever wrote it, the same way its
+// author could.
+func (cfg *apiConfig) handlerRemoveChirp(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
+
+	moderatorID, ok := userIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	reason, ok := decodeModerationReason(w, r)
+	if !ok {
+		return
+	}
+
+	logged, err := cfg.removeChirp(r.Context(), moderatorID, chirpID, reason)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Chirp not found")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, databaseModerationActionToModerationAction(logged))
+}
+
+// removeChirp deletes a chirp on behalf of a moderator and logs it. It
+// returns sql.ErrNoRows if the chirp doesn't exist or is already deleted.
+func (cfg *apiConfig) removeChirp(ctx context.Context, moderatorID, chirpID uuid.UUID, reason string) (database.ModerationAction, error) {
+	tx, err := cfg.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return database.ModerationAction{}, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	chirp, err := qtx.GetChirpByIdForUpdate(ctx, chirpID)
+	if err != nil {
+		return database.ModerationAction{}, err
+	}
+	if chirp.DeletedAt.Valid {
+		return database.ModerationAction{}, sql.ErrNoRows
+	}
+
+	if err := deleteChirp(ctx, qtx, chirp.ID); err != nil {
+		return database.ModerationAction{}, err
+	}
+
+	logged, err := qtx.CreateModerationAction(ctx, database.CreateModerationActionParams{
+		ModeratorID:   uuid.NullUUID{UUID: moderatorID, Valid: true},
+		Action:        moderationActionRemoveChirp,
+		TargetUserID:  uuid.NullUUID{UUID: chirp.UserID, Valid: true},
+		TargetChirpID: uuid.NullUUID{UUID: chirp.ID, Valid: true},
+		Reason:        reason,
+	})
+	if err != nil {
+		return database.ModerationAction{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return database.ModerationAction{}, err
+	}
+	return logged, nil
+}
+
+// decodeModerationReason reads a body holding only a reason. It responds
+// with an error and returns false when the reason is missing or too long.
+func decodeModerationReason(w http.ResponseWriter, r *http.Request) (string, bool) {
+	type parameters struct {
+		Reason string `json:"reason"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	var params parameters
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Something went wrong")
+		return "", false
+	}
+
+	reason, ok := parseModerationReason(params.Reason)
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Reason must be 1-500 characters")
+		return "", false
+	}
+
+	return reason, true
+}
+
+// handlerListModerationActions pages through the moderation log, newest
+// first, optionally only the actions taken against one user.
+func (cfg *apiConfig) handlerListModerationActions(w http.ResponseWriter, r *http.Request) {
+	limit, cursor, err := parsePageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var targetUserID uuid.NullUUID
+	if userIDStr := r.URL.Query().Get("user_id"); userIDStr != "" {
+		userID, err := uuid.Parse(userIDStr)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+			return
+		}
+		targetUserID = uuid.NullUUID{UUID: userID, Valid: true}
+	}
+
+	actions, err := cfg.db.ListModerationActions(r.Context(), database.ListModerationActionsParams{
+		TargetUserID:    targetUserID,
+		CursorCreatedAt: cursor.createdAt(),
+		CursorID:        cursor.id(),
+		RowLimit:        int32(limit + 1),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	var next *pageCursor
+	if len(actions) > limit {
+		actions = actions[:limit]
+		last := actions[len(actions)-1]
+		next = &pageCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+
+	response := make([]ModerationAction, 0, len(actions))
+	for _, action := range actions {
+		response = append(response, databaseModerationActionToModerationAction(action))
+	}
+
+	setPaginationLinks(w, r, next, nil)
+	respondWithJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebson1988/chirpy/internal/auth"
+	"github.com/glebson1988/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestSuspensionMessage(t *testing.T) {
+	now := time.Now().UTC()
+
+	tests := []struct {
+		name           string
+		bannedAt       sql.NullTime
+		suspendedUntil sql.NullTime
+		wantPrefix     string
+	}{
+		{name: "active"},
+		{name: "banned", bannedAt: sql.NullTime{Time: now, Valid: true}, wantPrefix: "Account is banned"},
+		{name: "suspended", suspendedUntil: sql.NullTime{Time: now.Add(time.Hour), Valid: true}, wantPrefix: "Account is suspended until"},
+		{name: "suspension over", suspendedUntil: sql.NullTime{Time: now.Add(-time.Hour), Valid: true}},
+	}
+
+	for _, tt := range tests {
+		got := suspensionMessage(tt.bannedAt, tt.suspendedUntil)
+		if (got == "") != (tt.wantPrefix == "") || !strings.HasPrefix(got, tt.wantPrefix) {
+			t.Fatalf("%s: suspensionMessage() = %q, want prefix %q", tt.name, got, tt.wantPrefix)
+		}
+	}
+}
+
+func TestHandlerRefreshSuspendedUser(t *testing.T) {
+	familyID := uuid.New()
+	revokedFamily := false
+	db := &stubDB{
+		getUserFromRefreshToken: func(ctx context.Context, id string) (database.GetUserFromRefreshTokenRow, error) {
+			return database.GetUserFromRefreshTokenRow{
+				UserID:         uuid.New(),
+				ExpiresAt:      time.Now().UTC().Add(time.Hour),
+				TokenHash:      testRefreshTokenHash,
+				FamilyID:       familyID,
+				SuspendedUntil: sql.NullTime{Time: time.Now().UTC().Add(time.Hour), Valid: true},
+			}, nil
+		},
+		revokeRefreshTokenFamily: func(ctx context.Context, id uuid.UUID) error {
+			revokedFamily = id == familyID
+			return nil
+		},
+	}
+	cfg := &apiConfig{
+		tokenKeys:  newTestKeyring(t),
+		tokenStore: db,
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/refresh", nil)
+	req.Header.Set("Authorization", "Bearer "+testRefreshToken)
+	rec := httptest.NewRecorder()
+
+	cfg.handlerRefresh(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("handlerRefresh() status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	if !revokedFamily {
+		t.Fatal("handlerRefresh() didn't revoke the suspended user's session")
+	}
+}
+
+func TestHandlerSuspendUserRejectsInvalidParams(t *testing.T) {
+	cfg := &apiConfig{}
+
+	for _, body := range []string{
+		`{"duration_hours": 0, "reason": "spam"}`,
+		`{"duration_hours": 8761, "reason": "spam"}`,
+		`{"duration_hours": 24, "reason": "   "}`,
+		`{"duration_hours": 24, "reason": "` + strings.Repeat("x", 501) + `"}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/moderation/users/"+uuid.NewString()+"/suspend", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+
+		cfg.handlerSuspendUser(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("handlerSuspendUser(%.40s) status = %d, want %d", body, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+// loggedModerationAction answers CreateModerationAction with the row its
+// arguments describe.
+func loggedModerationAction(args []driver.Value) fakeResult {
+	nullUUID := func(v driver.Value) uuid.NullUUID {
+		id, ok := v.(string)
+		if !ok {
+			return uuid.NullUUID{}
+		}
+		return uuid.NullUUID{UUID: uuid.MustParse(id), Valid: true}
+	}
+	return fakeRows(database.ModerationAction{
+		ID:            uuid.New(),
+		ModeratorID:   nullUUID(args[0]),
+		Action:        args[1].(string),
+		TargetUserID:  nullUUID(args[2]),
+		TargetChirpID: nullUUID(args[3]),
+		Reason:        args[4].(string),
+		CreatedAt:     time.Now().UTC(),
+		ReportID:      nullUUID(args[6]),
+	})
+}
+
+func TestModerateUserRankCheck(t *testing.T) {
+	moderatorID := uuid.New()
+
+	tests := []struct {
+		name       string
+		callerRole string
+		targetID   uuid.UUID
+		targetRole string
+		wantStatus int
+	}{
+		{name: "moderator on user", callerRole: auth.RoleModerator, targetID: uuid.New(), targetRole: auth.RoleUser, wantStatus: http.StatusCreated},
+		{name: "moderator on moderator", callerRole: auth.RoleModerator, targetID: uuid.New(), targetRole: auth.RoleModerator, wantStatus: http.StatusForbidden},
+		{name: "moderator on themselves", callerRole: auth.RoleModerator, targetID: moderatorID, targetRole: auth.RoleModerator, wantStatus: http.StatusForbidden},
+		{name: "moderator on admin", callerRole: auth.RoleModerator, targetID: uuid.New(), targetRole: auth.RoleAdmin, wantStatus: http.StatusForbidden},
+		{name: "admin on moderator", callerRole: auth.RoleAdmin, targetID: uuid.New(), targetRole: auth.RoleModerator, wantStatus: http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, db := newFakeDBConfig(t)
+			db.on("GetUserByID", func(args []driver.Value) fakeResult {
+				return fakeRows(database.User{ID: tt.targetID, Email: "target@example.com", Role: tt.targetRole})
+			})
+			db.on("CreateModerationAction", loggedModerationAction)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/moderation/users/"+tt.targetID.String()+"/ban", strings.NewReader(`{"reason": "spam"}`))
+			req.SetPathValue("userID", tt.targetID.String())
+			req = requestAs(req, principal{UserID: moderatorID, Role: tt.callerRole})
+			rec := httptest.NewRecorder()
+
+			cfg.handlerBanUser(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("handlerBanUser() status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+
+			wantWrites := 0
+			if tt.wantStatus == http.StatusCreated {
+				wantWrites = 1
+			}
+			for _, name := range []string{"BanUser", "RevokeUserRefreshTokens", "CreateModerationAction"} {
+				if calls := db.committedCalls(name); len(calls) != wantWrites {
+					t.Fatalf("handlerBanUser() committed %s %d times, want %d", name, len(calls), wantWrites)
+				}
+			}
+		})
+	}
+}
+
+func TestHandlerRemoveChirp(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	moderatorID := uuid.New()
+	live := database.Chirp{ID: uuid.New(), CreatedAt: start, UpdatedAt: start, Body: "spam", UserID: uuid.New()}
+	deleted := database.Chirp{ID: uuid.New(), CreatedAt: start, UpdatedAt: start, UserID: uuid.New(), DeletedAt: sql.NullTime{Time: start, Valid: true}}
+
+	tests := []struct {
+		name       string
+		chirpID    uuid.UUID
+		wantStatus int
+	}{
+		{name: "live chirp", chirpID: live.ID, wantStatus: http.StatusCreated},
+		{name: "already deleted", chirpID: deleted.ID, wantStatus: http.StatusNotFound},
+		{name: "missing", chirpID: uuid.New(), wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, db := newFakeDBConfig(t)
+			db.on("GetChirpByIdForUpdate", chirpsByID(live, deleted))
+			db.on("ChirpIsReferenced", func(args []driver.Value) fakeResult {
+				return fakeRows(false)
+			})
+			db.on("CreateModerationAction", loggedModerationAction)
+
+			req := httptest.NewRequest(http.MethodDelete, "/api/moderation/chirps/"+tt.chirpID.String(), strings.NewReader(`{"reason": "spam"}`))
+			req.SetPathValue("chirpID", tt.chirpID.String())
+			req = requestAs(req, principal{UserID: moderatorID, Role: auth.RoleModerator})
+			rec := httptest.NewRecorder()
+
+			cfg.handlerRemoveChirp(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("handlerRemoveChirp() status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+
+			logged := db.committedCalls("CreateModerationAction")
+			if tt.wantStatus != http.StatusCreated {
+				if len(logged) != 0 || len(db.calls("DeleteChirp")) != 0 {
+					t.Fatalf("handlerRemoveChirp() deleted or logged a chirp it couldn't remove")
+				}
+				return
+			}
+
+			if calls := db.committedCalls("DeleteChirp"); len(calls) != 1 || calls[0].args[0] != live.ID.String() {
+				t.Fatalf("handlerRemoveChirp() didn't delete the chirp")
+			}
+			if len(logged) != 1 {
+				t.Fatalf("handlerRemoveChirp() logged %d actions, want 1", len(logged))
+			}
+			want := []driver.Value{moderatorID.String(), moderationActionRemoveChirp, live.UserID.String(), live.ID.String(), "spam"}
+			for i, arg := range want {
+				if logged[0].args[i] != arg {
+					t.Fatalf("CreateModerationAction arg %d = %v, want %v", i+1, logged[0].args[i], arg)
+				}
+			}
+		})
+	}
+}
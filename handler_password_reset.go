@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/glebson1988/chirpy/internal/auth"
+	"github.com/glebson1988/chirpy/internal/database"
+	"github.com/glebson1988/chirpy/internal/mailer"
+)
+
+const (
+	passwordResetTTL         = time.Hour
+	passwordResetSendTimeout = 30 * time.Second
+	// passwordResetCooldown is how long after one reset email another
+	// can't be requested for the same account, unless the first was used.
+	passwordResetCooldown = 15 * time.Minute
+	// maxPendingPasswordResets caps the reset emails being sent at once.
+	maxPendingPasswordResets = 16
+)
+
+// passwordResetSlots holds one token for each reset email being sent.
+var passwordResetSlots = make(chan struct{}, maxPendingPasswordResets)
+
+// handlerForgotPassword emails a reset token if the address belongs to an
+// account. The response is the same either way, and the token is created
+// and sent after responding, so neither the body nor the timing tells
+// anyone who has signed up. Requests beyond the cooldown or the cap on
+// pending sends get the same response and send nothing.
+func (cfg *apiConfig) handlerForgotPassword(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Email string `json:"email"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	var params parameters
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Something went wrong")
+		return
+	}
+
+	user, err := cfg.db.GetUserByEmail(r.Context(), params.Email)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	select {
+	case passwordResetSlots <- struct{}{}:
+		go func() {
+			defer func() { <-passwordResetSlots }()
+			cfg.sendPasswordReset(user)
+		}()
+	default:
+		log.Printf("Dropped password reset for user %s: too many pending", user.ID)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// sendPasswordReset creates a reset token for user and emails it, unless
+// one was sent within passwordResetCooldown and is still unused. It runs
+// after the request has been answered, so failures are only logged.
+func (cfg *apiConfig) sendPasswordReset(user database.User) {
+	ctx, cancel := context.WithTimeout(context.Background(), passwordResetSendTimeout)
+	defer cancel()
+
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		log.Printf("Failed to create password reset token for user %s: %v", user.ID, err)
+		return
+	}
+
+	now := time.Now().UTC()
+	created, err := cfg.db.CreatePasswordResetToken(ctx, database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		ExpiresAt: now.Add(passwordResetTTL),
+		Since:     now.Add(-passwordResetCooldown),
+	})
+	if err != nil {
+		log.Printf("Failed to store password reset token for user %s: %v", user.ID, err)
+		return
+	}
+	if created == 0 {
+		return
+	}
+
+	if err := cfg.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf(
+			"Someone asked to reset the password for this account. To choose a new one, send the token below with your new password to %s/api/password/reset within an hour:\n\n%s\n\nIf it wasn't you, you can ignore this email.",
+			cfg.baseURL, token,
+		),
+	}); err != nil {
+		log.Printf("Failed to send password reset email to user %s: %v", user.ID, err)
+	}
+}
+
+// handlerResetPassword sets a new password using a token from
+// handlerForgotPassword. Every outstanding reset token, refresh token and
+// personal access token for the user is invalidated.
+func (cfg *apiConfig) handlerResetPassword(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	var params parameters
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Something went wrong")
+		return
+	}
+
+	if params.Token == "" || params.Password == "" {
+		respondWithError(w, http.StatusBadRequest, "Something went wrong")
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(params.Password)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	userID, err := qtx.UsePasswordResetToken(r.Context(), auth.HashToken(params.Token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusBadRequest, "Invalid or expired token")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	if err := qtx.SetUserPassword(r.Context(), database.SetUserPasswordParams{
+		ID:             userID,
+		HashedPassword: hashedPassword,
+	}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	if err := qtx.ExpirePasswordResetTokens(r.Context(), userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	if err := qtx.RevokeUserRefreshTokens(r.Context(), userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	if err := qtx.RevokeUserPersonalAccessTokens(r.Context(), userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebson1988/chirpy/internal/auth"
+	"github.com/glebson1988/chirpy/internal/database"
+	"github.com/glebson1988/chirpy/internal/mailer"
+	"github.com/google/uuid"
+)
+
+// recordingMailer hands every message it is asked to send to sent.
+type recordingMailer struct {
+	sent chan mailer.Message
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m.sent <- msg
+	return nil
+}
+
+func TestHandlerResetPasswordRequiresFields(t *testing.T) {
+	cfg := &apiConfig{}
+
+	for _, body := range []string{`{"token": "abc"}`, `{"password": "pw"}`} {
+		req := httptest.NewRequest(http.MethodPost, "/api/password/reset", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+
+		cfg.handlerResetPassword(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("handlerResetPassword(%s) status = %d, want %d", body, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+type fakeResetToken struct {
+	userID    uuid.UUID
+	expiresAt time.Time
+	used      bool
+}
+
+func TestHandlerResetPassword(t *testing.T) {
+	userID := uuid.New()
+
+	tests := []struct {
+		name       string
+		token      fakeResetToken
+		uses       int
+		wantStatus int
+	}{
+		{name: "valid", token: fakeResetToken{userID: userID, expiresAt: time.Now().Add(time.Hour)}, uses: 1, wantStatus: http.StatusNoContent},
+		{name: "used twice", token: fakeResetToken{userID: userID, expiresAt: time.Now().Add(time.Hour)}, uses: 2, wantStatus: http.StatusBadRequest},
+		{name: "expired", token: fakeResetToken{userID: userID, expiresAt: time.Now().Add(-time.Minute)}, uses: 1, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, db := newFakeDBConfig(t)
+			token := tt.token
+			db.on("UsePasswordResetToken", func(args []driver.Value) fakeResult {
+				if args[0] != auth.HashToken("reset-token") || token.used || !token.expiresAt.After(time.Now()) {
+					return fakeResult{}
+				}
+				token.used = true
+				return fakeRows(token.userID)
+			})
+
+			var rec *httptest.ResponseRecorder
+			for i := 0; i < tt.uses; i++ {
+				req := httptest.NewRequest(http.MethodPost, "/api/password/reset", strings.NewReader(`{"token": "reset-token", "password": "new password"}`))
+				rec = httptest.NewRecorder()
+
+				cfg.handlerResetPassword(rec, req)
+			}
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("handlerResetPassword() status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+
+			// Only a successful reset changes the password and signs the
+			// user out everywhere; a token used twice did so the first time.
+			wantWrites := 0
+			if tt.wantStatus == http.StatusNoContent || tt.uses > 1 {
+				wantWrites = 1
+			}
+			for _, name := range []string{"SetUserPassword", "ExpirePasswordResetTokens", "RevokeUserRefreshTokens", "RevokeUserPersonalAccessTokens"} {
+				calls := db.committedCalls(name)
+				if len(calls) != wantWrites {
+					t.Fatalf("handlerResetPassword() committed %s %d times, want %d", name, len(calls), wantWrites)
+				}
+				for _, call := range calls {
+					if call.args[0] != userID.String() {
+						t.Fatalf("%s ran for %v, want %v", name, call.args[0], userID)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestHandlerForgotPasswordHidesWhetherEmailExists(t *testing.T) {
+	cfg, db := newFakeDBConfig(t)
+	sent := &recordingMailer{sent: make(chan mailer.Message, 1)}
+	cfg.mailer = sent
+	user := database.User{ID: uuid.New(), Email: "user@example.com", Role: auth.RoleUser}
+
+	db.on("GetUserByEmail", func(args []driver.Value) fakeResult {
+		if args[0] != user.Email {
+			return fakeResult{}
+		}
+		return fakeRows(user)
+	})
+	db.on("CreatePasswordResetToken", func(args []driver.Value) fakeResult {
+		return fakeRowsAffected(1)
+	})
+
+	forgot := func(email string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/password/forgot", strings.NewReader(`{"email": "`+email+`"}`))
+		rec := httptest.NewRecorder()
+
+		cfg.handlerForgotPassword(rec, req)
+
+		return rec
+	}
+
+	known := forgot(user.Email)
+	unknown := forgot("nobody@example.com")
+
+	if known.Code != http.StatusAccepted || unknown.Code != http.StatusAccepted {
+		t.Fatalf("status = %d for a known email and %d for an unknown one, want %d", known.Code, unknown.Code, http.StatusAccepted)
+	}
+	if !reflect.DeepEqual(known.Header(), unknown.Header()) || known.Body.String() != unknown.Body.String() {
+		t.Fatalf("responses differ: %v %q and %v %q", known.Header(), known.Body, unknown.Header(), unknown.Body)
+	}
+
+	select {
+	case msg := <-sent.sent:
+		if msg.To != user.Email {
+			t.Fatalf("reset email sent to %q, want %q", msg.To, user.Email)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reset email sent for a known address")
+	}
+}
+
+func TestSendPasswordResetCooldown(t *testing.T) {
+	cfg, db := newFakeDBConfig(t)
+	sent := &recordingMailer{sent: make(chan mailer.Message, 2)}
+	cfg.mailer = sent
+	user := database.User{ID: uuid.New(), Email: "user@example.com", Role: auth.RoleUser}
+
+	// The insert is skipped while an unused token newer than the cooldown
+	// exists.
+	var lastCreated time.Time
+	db.on("CreatePasswordResetToken", func(args []driver.Value) fakeResult {
+		if lastCreated.After(args[3].(time.Time)) {
+			return fakeRowsAffected(0)
+		}
+		lastCreated = time.Now().UTC()
+		return fakeRowsAffected(1)
+	})
+
+	cfg.sendPasswordReset(user)
+	cfg.sendPasswordReset(user)
+
+	if len(sent.sent) != 1 {
+		t.Fatalf("sent %d reset emails within the cooldown, want 1", len(sent.sent))
+	}
+}
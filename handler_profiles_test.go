@@ -0,0 +1,149 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebson1988/chirpy/internal/auth"
+	"github.com/glebson1988/chirpy/internal/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+func TestValidAvatarURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{url: "", want: true},
+		{url: "https://example.com/me.png", want: true},
+		{url: "http://example.com/me.png", want: true},
+		{url: "javascript:alert(1)", want: false},
+		{url: "/relative.png", want: false},
+		{url: "https://", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := validAvatarURL(tt.url); got != tt.want {
+			t.Fatalf("validAvatarURL(%q) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestHandlerGetUserProfileOmitsEmail(t *testing.T) {
+	cfg, db := newFakeDBConfig(t)
+	profile := database.GetUserProfileRow{
+		ID:          uuid.New(),
+		CreatedAt:   time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Handle:      sql.NullString{String: "someone", Valid: true},
+		DisplayName: "Someone",
+		ChirpCount:  3,
+	}
+	db.on("GetUserProfile", func(args []driver.Value) fakeResult {
+		return fakeRows(profile)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/users/"+profile.ID.String(), nil)
+	req.SetPathValue("userID", profile.ID.String())
+	rec := httptest.NewRecorder()
+
+	cfg.handlerGetUserProfile(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("handlerGetUserProfile() status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	var got map[string]any
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if _, ok := got["email"]; ok {
+		t.Fatalf("handlerGetUserProfile() returned an email: %v", got)
+	}
+	if got["handle"] != "someone" || got["chirp_count"] != float64(3) {
+		t.Fatalf("handlerGetUserProfile() = %v", got)
+	}
+}
+
+// fakePatchUser answers PatchUser for user the way its COALESCEs do:
+// fields passed as NULL keep their value.
+func fakePatchUser(user *database.User) func(args []driver.Value) fakeResult {
+	return func(args []driver.Value) fakeResult {
+		for i, field := range []*string{&user.Email, &user.HashedPassword, &user.Handle.String, &user.DisplayName, &user.Bio, &user.AvatarUrl} {
+			if value, ok := args[i].(string); ok {
+				*field = value
+			}
+		}
+		return fakeRows(*user)
+	}
+}
+
+func patchUser(t *testing.T, cfg *apiConfig, userID uuid.UUID, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPatch, "/api/users/me", strings.NewReader(body))
+	req = requestAs(req, principal{UserID: userID, Role: auth.RoleUser, Scopes: []string{auth.ScopeUsersWrite}})
+	rec := httptest.NewRecorder()
+
+	cfg.handlerPatchUser(rec, req)
+
+	return rec
+}
+
+func TestHandlerPatchUserPartialUpdate(t *testing.T) {
+	cfg, db := newFakeDBConfig(t)
+	user := database.User{
+		ID:          uuid.New(),
+		Email:       "user@example.com",
+		Handle:      sql.NullString{String: "someone", Valid: true},
+		DisplayName: "Someone",
+		Bio:         "old bio",
+		AvatarUrl:   "https://example.com/me.png",
+		Role:        auth.RoleUser,
+	}
+	db.on("PatchUser", fakePatchUser(&user))
+
+	rec := patchUser(t, cfg, user.ID, `{"bio": "new bio"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("handlerPatchUser() status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	calls := db.calls("PatchUser")
+	for i, name := range []string{"email", "hashed_password", "handle", "display_name"} {
+		if calls[0].args[i] != nil {
+			t.Fatalf("handlerPatchUser() set %s = %v for a field it wasn't sent", name, calls[0].args[i])
+		}
+	}
+	var got User
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if got.Bio != "new bio" || got.DisplayName != "Someone" || got.Handle != "someone" || got.AvatarURL != "https://example.com/me.png" {
+		t.Fatalf("handlerPatchUser() = %+v, want only the bio changed", got)
+	}
+
+	// An empty string clears a field, still leaving the others alone.
+	rec = patchUser(t, cfg, user.ID, `{"display_name": ""}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("handlerPatchUser() status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if user.DisplayName != "" || user.Bio != "new bio" {
+		t.Fatalf("after clearing display_name: display_name = %q, bio = %q", user.DisplayName, user.Bio)
+	}
+}
+
+func TestHandlerPatchUserDuplicateHandle(t *testing.T) {
+	cfg, db := newFakeDBConfig(t)
+	db.on("PatchUser", func(args []driver.Value) fakeResult {
+		return fakeErr(&pq.Error{Code: "23505", Constraint: "users_handle_key"})
+	})
+
+	rec := patchUser(t, cfg, uuid.New(), `{"handle": "taken"}`)
+
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("handlerPatchUser() status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+}
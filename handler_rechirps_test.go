@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/glebson1988/chirpy/internal/auth"
+	"github.com/glebson1988/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// chirpsByID answers GetChirpById from chirps.
+func chirpsByID(chirps ...database.Chirp) func(args []driver.Value) fakeResult {
+	return func(args []driver.Value) fakeResult {
+		for _, chirp := range chirps {
+			if args[0] == chirp.ID.String() {
+				return fakeRows(chirp)
+			}
+		}
+		return fakeResult{}
+	}
+}
+
+func TestHandlerRechirp(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	authorID := uuid.New()
+	original := database.Chirp{ID: uuid.New(), CreatedAt: start, UpdatedAt: start, Body: "original", UserID: authorID}
+
+	tests := []struct {
+		name          string
+		callerID      uuid.UUID
+		alreadyExists bool
+		wantStatus    int
+	}{
+		{name: "someone else's chirp", callerID: uuid.New(), wantStatus: http.StatusCreated},
+		{name: "already rechirped", callerID: uuid.New(), alreadyExists: true, wantStatus: http.StatusConflict},
+		{name: "own chirp", callerID: authorID, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, db := newFakeDBConfig(t)
+			db.on("GetChirpById", chirpsByID(original))
+			// ON CONFLICT DO NOTHING returns no row for a duplicate.
+			db.on("CreateRechirp", func(args []driver.Value) fakeResult {
+				if tt.alreadyExists {
+					return fakeResult{}
+				}
+				return fakeRows(database.Chirp{
+					ID:          uuid.New(),
+					CreatedAt:   start.Add(time.Hour),
+					UpdatedAt:   start.Add(time.Hour),
+					UserID:      tt.callerID,
+					RechirpOfID: uuid.NullUUID{UUID: original.ID, Valid: true},
+				})
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/api/chirps/"+original.ID.String()+"/rechirps", nil)
+			req.SetPathValue("chirpID", original.ID.String())
+			req = requestAs(req, principal{UserID: tt.callerID, Role: auth.RoleUser})
+			rec := httptest.NewRecorder()
+
+			cfg.handlerRechirp(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("handlerRechirp() status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.callerID == authorID && len(db.calls("CreateRechirp")) != 0 {
+				t.Fatalf("handlerRechirp() created a rechirp of the caller's own chirp")
+			}
+		})
+	}
+}
+
+func TestHandlerLikeChirpOnRechirpLikesOriginal(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	original := database.Chirp{ID: uuid.New(), CreatedAt: start, UpdatedAt: start, Body: "original", UserID: uuid.New()}
+	rechirp := database.Chirp{
+		ID:          uuid.New(),
+		CreatedAt:   start.Add(time.Hour),
+		UpdatedAt:   start.Add(time.Hour),
+		UserID:      uuid.New(),
+		RechirpOfID: uuid.NullUUID{UUID: original.ID, Valid: true},
+	}
+
+	tests := []struct {
+		name    string
+		method  string
+		query   string
+		handler func(cfg *apiConfig) http.HandlerFunc
+	}{
+		{name: "like", method: http.MethodPost, query: "LikeChirp", handler: func(cfg *apiConfig) http.HandlerFunc { return cfg.handlerLikeChirp }},
+		{name: "unlike", method: http.MethodDelete, query: "UnlikeChirp", handler: func(cfg *apiConfig) http.HandlerFunc { return cfg.handlerUnlikeChirp }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, db := newFakeDBConfig(t)
+			db.on("GetChirpById", chirpsByID(original, rechirp))
+
+			req := httptest.NewRequest(tt.method, "/api/chirps/"+rechirp.ID.String()+"/likes", nil)
+			req.SetPathValue("chirpID", rechirp.ID.String())
+			req = requestAs(req, principal{UserID: uuid.New(), Role: auth.RoleUser})
+			rec := httptest.NewRecorder()
+
+			tt.handler(cfg)(rec, req)
+
+			if rec.Code != http.StatusNoContent {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusNoContent)
+			}
+			calls := db.calls(tt.query)
+			if len(calls) != 1 {
+				t.Fatalf("%s ran %d times, want 1", tt.query, len(calls))
+			}
+			if chirpID := calls[0].args[1]; chirpID != original.ID.String() {
+				t.Fatalf("%s chirp_id = %v, want the original %v", tt.query, chirpID, original.ID)
+			}
+		})
+	}
+}
+
+func TestDeleteChirp(t *testing.T) {
+	tests := []struct {
+		name          string
+		referenced    bool
+		wantTombstone bool
+	}{
+		{name: "quoted or replied to", referenced: true, wantTombstone: true},
+		{name: "unreferenced", referenced: false, wantTombstone: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, db := newFakeDBConfig(t)
+			chirpID := uuid.New()
+			db.on("ChirpIsReferenced", func(args []driver.Value) fakeResult {
+				return fakeRows(tt.referenced)
+			})
+
+			if err := deleteChirp(context.Background(), cfg.db, chirpID); err != nil {
+				t.Fatalf("deleteChirp() error = %v", err)
+			}
+
+			tombstoned := len(db.calls("TombstoneChirp")) == 1
+			deleted := len(db.calls("DeleteChirp")) == 1
+			if tombstoned != tt.wantTombstone || deleted == tt.wantTombstone {
+				t.Fatalf("deleteChirp() tombstoned = %v, deleted = %v; want tombstone = %v", tombstoned, deleted, tt.wantTombstone)
+			}
+			if !tt.wantTombstone {
+				return
+			}
+			// A tombstone keeps nothing of the chirp but its place in threads
+			// and quotes.
+			for _, name := range []string{"DeleteRechirpsOf", "DeleteChirpRevisions", "DeleteChirpHashtags", "DeleteChirpMentions"} {
+				if len(db.calls(name)) != 1 {
+					t.Fatalf("deleteChirp() didn't run %s before tombstoning", name)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/glebson1988/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	reportStatusOpen      = "open"
+	reportStatusClaimed   = "claimed"
+	reportStatusResolved  = "resolved"
+	reportStatusDismissed = "dismissed"
+
+	moderationActionClaimReport   = "claim_report"
+	moderationActionResolveReport = "resolve_report"
+	moderationActionDismissReport = "dismiss_report"
+
+	maxReportDetailsLength = 1000
+)
+
+var reportCategories = map[string]bool{
+	"spam":           true,
+	"harassment":     true,
+	"hate_speech":    true,
+	"violence":       true,
+	"sexual_content": true,
+	"impersonation":  true,
+	"other":          true,
+}
+
+var reportStatuses = map[string]bool{
+	reportStatusOpen:      true,
+	reportStatusClaimed:   true,
+	reportStatusResolved:  true,
+	reportStatusDismissed: true,
+}
+
+// Report is a user's complaint about a chirp or an account. UserID is the
+// reported account, which for chirp reports is the chirp's author; it is
+// null once that account is deleted.
+type Report struct {
+	ID         uuid.UUID  `json:"id"`
+	ReporterID uuid.UUID  `json:"reporter_id"`
+	ChirpID    *uuid.UUID `json:"chirp_id"`
+	UserID     *uuid.UUID `json:"user_id"`
+	Category   string     `json:"category"`
+	Details    string     `json:"details"`
+	Status     string     `json:"status"`
+	AssigneeID *uuid.UUID `json:"assignee_id"`
+	Resolution string     `json:"resolution"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	ClaimedAt  *time.Time `json:"claimed_at"`
+	ClosedAt   *time.Time `json:"closed_at"`
+}
+
+func databaseReportToReport(report database.Report) Report {
+	response := Report{
+		ID:         report.ID,
+		ReporterID: report.ReporterID,
+		Category:   report.Category,
+		Details:    report.Details,
+		Status:     report.Status,
+		Resolution: report.Resolution,
+		CreatedAt:  report.CreatedAt,
+		UpdatedAt:  report.UpdatedAt,
+	}
+	if report.ChirpID.Valid {
+		response.ChirpID = &report.ChirpID.UUID
+	}
+	if report.UserID.Valid {
+		response.UserID = &report.UserID.UUID
+	}
+	if report.AssigneeID.Valid {
+		response.AssigneeID = &report.AssigneeID.UUID
+	}
+	if report.ClaimedAt.Valid {
+		response.ClaimedAt = &report.ClaimedAt.Time
+	}
+	if report.ClosedAt.Valid {
+		response.ClosedAt = &report.ClosedAt.Time
+	}
+	return response
+}
+
+// decodeReportParams reads the body of a new report. It responds with an
+// error and returns false when the category or details are invalid.
+func decodeReportParams(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	type parameters struct {
+		Category string `json:"category"`
+		Details  string `json:"details"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	var params parameters
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Something went wrong")
+		return "", "", false
+	}
+
+	if !reportCategories[params.Category] {
+		respondWithError(w, http.StatusBadRequest, "Unknown report category")
+		return "", "", false
+	}
+	details := strings.TrimSpace(params.Details)
+	if utf8.RuneCountInString(details) > maxReportDetailsLength {
+		respondWithError(w, http.StatusBadRequest, "Details can't be longer than 1000 characters")
+		return "", "", false
+	}
+
+	return params.Category, details, true
+}
+
+// createReport files a report and responds with it, or with 409 if the
+// reporter already reported the same chirp or account.
+func (cfg *apiConfig) createReport(w http.ResponseWriter, r *http.Request, arg database.CreateReportParams) {
+	report, err := cfg.db.CreateReport(r.Context(), arg)
+	if err != nil {
+		if isUniqueViolation(err, "reports_reporter_chirp_key") || isUniqueViolation(err, "reports_reporter_user_key") {
+			respondWithError(w, http.StatusConflict, "You have already reported this")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, databaseReportToReport(report))
+}
+
+func (cfg *apiConfig) handlerReportChirp(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
+
+	reporterID, ok := userIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	category, details, ok := decodeReportParams(w, r)
+	if !ok {
+		return
+	}
+
+	chirp, err := cfg.db.GetChirpById(r.Context(), chirpID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Chirp not found")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if chirp.DeletedAt.Valid {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
+	if chirp.UserID == reporterID {
+		respondWithError(w, http.StatusBadRequest, "You can't report your own chirp")
+		return
+	}
+
+	cfg.createReport(w, r, database.CreateReportParams{
+		ReporterID: reporterID,
+		ChirpID:    uuid.NullUUID{UUID: chirp.ID, Valid: true},
+		UserID:     uuid.NullUUID{UUID: chirp.UserID, Valid: true},
+		Category:   category,
+		Details:    details,
+	})
+}
+
+func (cfg *apiConfig) handlerReportUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	reporterID, ok := userIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	category, details, ok := decodeReportParams(w, r)
+	if !ok {
+		return
+	}
+
+	if userID == reporterID {
+		respondWithError(w, http.StatusBadRequest, "You can't report yourself")
+		return
+	}
+	if _, err := cfg.db.GetUserByID(r.Context(), userID); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "User not found")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	cfg.createReport(w, r, database.CreateReportParams{
+		ReporterID: reporterID,
+		UserID:     uuid.NullUUID{UUID: userID, Valid: true},
+		Category:   category,
+		Details:    details,
+	})
+}
+
+// handlerListReports pages through reports with one status, oldest first,
+// so the queue is worked in the order reports came in.
+func (cfg *apiConfig) handlerListReports(w http.ResponseWriter, r *http.Request) {
+	limit, cursor, err := parsePageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = reportStatusOpen
+	}
+	if !reportStatuses[status] {
+		respondWithError(w, http.StatusBadRequest, "Unknown report status")
+		return
+	}
+
+	reports, err := cfg.db.ListReports(r.Context(), database.ListReportsParams{
+		Status:          status,
+		CursorCreatedAt: cursor.createdAt(),
+		CursorID:        cursor.id(),
+		RowLimit:        int32(limit + 1),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	var next *pageCursor
+	if len(reports) > limit {
+		reports = reports[:limit]
+		last := reports[len(reports)-1]
+		next = &pageCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+
+	response := make([]Report, 0, len(reports))
+	for _, report := range reports {
+		response = append(response, databaseReportToReport(report))
+	}
+
+	setPaginationLinks(w, r, next, nil)
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// handlerClaimReport assigns an open report to the caller so nobody else
+// works on it at the same time.
+func (cfg *apiConfig) handlerClaimReport(w http.ResponseWriter, r *http.Request) {
+	reportID, err := uuid.Parse(r.PathValue("reportID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid report ID")
+		return
+	}
+
+	moderatorID, ok := userIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	report, err := cfg.updateReport(r.Context(), moderatorID, moderationActionClaimReport, "", func(q *database.Queries) (database.Report, error) {
+		return q.ClaimReport(r.Context(), database.ClaimReportParams{
+			ID:         reportID,
+			AssigneeID: uuid.NullUUID{UUID: moderatorID, Valid: true},
+		})
+	})
+	if err != nil {
+		cfg.respondWithReportUpdateError(w, r, reportID, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, databaseReportToReport(report))
+}
+
+func (cfg *apiConfig) handlerResolveReport(w http.ResponseWriter, r *http.Request) {
+	cfg.closeReport(w, r, reportStatusResolved, moderationActionResolveReport)
+}
+
+func (cfg *apiConfig) handlerDismissReport(w http.ResponseWriter, r *http.Request) {
+	cfg.closeReport(w, r, reportStatusDismissed, moderationActionDismissReport)
+}
+
+// closeReport resolves or dismisses a report that is open or claimed by the
+// caller. Closing a report doesn't act on what was reported; moderators do
+// that separately and say what they did in the reason.
+func (cfg *apiConfig) closeReport(w http.ResponseWriter, r *http.Request, status, action string) {
+	reportID, err := uuid.Parse(r.PathValue("reportID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid report ID")
+		return
+	}
+
+	moderatorID, ok := userIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	reason, ok := decodeModerationReason(w, r)
+	if !ok {
+		return
+	}
+
+	report, err := cfg.updateReport(r.Context(), moderatorID, action, reason, func(q *database.Queries) (database.Report, error) {
+		return q.CloseReport(r.Context(), database.CloseReportParams{
+			Status:     status,
+			AssigneeID: uuid.NullUUID{UUID: moderatorID, Valid: true},
+			Resolution: reason,
+			ID:         reportID,
+		})
+	})
+	if err != nil {
+		cfg.respondWithReportUpdateError(w, r, reportID, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, databaseReportToReport(report))
+}
+
+// updateReport applies update and records it in the moderation log in one
+// transaction. update returns sql.ErrNoRows when the report isn't in a
+// state it can be changed from.
+func (cfg *apiConfig) updateReport(ctx context.Context, moderatorID uuid.UUID, action, reason string, update func(q *database.Queries) (database.Report, error)) (database.Report, error) {
+	tx, err := cfg.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return database.Report{}, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	report, err := update(qtx)
+	if err != nil {
+		return database.Report{}, err
+	}
+
+	if _, err := qtx.CreateModerationAction(ctx, database.CreateModerationActionParams{
+		ModeratorID:   uuid.NullUUID{UUID: moderatorID, Valid: true},
+		Action:        action,
+		TargetUserID:  report.UserID,
+		TargetChirpID: report.ChirpID,
+		Reason:        reason,
+		ReportID:      uuid.NullUUID{UUID: report.ID, Valid: true},
+	}); err != nil {
+		return database.Report{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return database.Report{}, err
+	}
+	return report, nil
+}
+
+// respondWithReportUpdateError tells a report that doesn't exist apart from
+// one that was already claimed or closed.
+func (cfg *apiConfig) respondWithReportUpdateError(w http.ResponseWriter, r *http.Request, reportID uuid.UUID, err error) {
+	if err != sql.ErrNoRows {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	report, err := cfg.db.GetReport(r.Context(), reportID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Report not found")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	respondWithError(w, http.StatusConflict, "Report is already "+report.Status)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebson1988/chirpy/internal/auth"
+	"github.com/glebson1988/chirpy/internal/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+func TestHandlerReportUserRejectsInvalidParams(t *testing.T) {
+	cfg := &apiConfig{}
+	reporterID := uuid.New()
+
+	tests := []struct {
+		name   string
+		userID uuid.UUID
+		body   string
+	}{
+		{name: "unknown category", userID: uuid.New(), body: `{"category": "rude"}`},
+		{name: "long details", userID: uuid.New(), body: `{"category": "spam", "details": "` + strings.Repeat("x", 1001) + `"}`},
+		{name: "self", userID: reporterID, body: `{"category": "spam"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/users/"+tt.userID.String()+"/reports", strings.NewReader(tt.body))
+			req.SetPathValue("userID", tt.userID.String())
+			req = req.WithContext(contextWithPrincipal(context.Background(), principal{UserID: reporterID}))
+			rec := httptest.NewRecorder()
+
+			cfg.handlerReportUser(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+func TestHandlerListReportsRejectsUnknownStatus(t *testing.T) {
+	cfg := &apiConfig{}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/moderation/reports?status=pending", nil)
+	rec := httptest.NewRecorder()
+
+	cfg.handlerListReports(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestHandlerReportChirpRejectsDuplicates(t *testing.T) {
+	cfg, db := newFakeDBConfig(t)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	reporterID := uuid.New()
+	chirp := database.Chirp{ID: uuid.New(), CreatedAt: start, UpdatedAt: start, Body: "spam", UserID: uuid.New()}
+
+	db.on("GetChirpById", chirpsByID(chirp))
+	// The second report from the same reporter hits the unique constraint.
+	filed := false
+	db.on("CreateReport", func(args []driver.Value) fakeResult {
+		if filed {
+			return fakeErr(&pq.Error{Code: "23505", Constraint: "reports_reporter_chirp_key"})
+		}
+		filed = true
+		return fakeRows(database.Report{
+			ID:         uuid.New(),
+			ReporterID: reporterID,
+			ChirpID:    uuid.NullUUID{UUID: chirp.ID, Valid: true},
+			UserID:     uuid.NullUUID{UUID: chirp.UserID, Valid: true},
+			Category:   args[3].(string),
+			Status:     reportStatusOpen,
+			CreatedAt:  start,
+			UpdatedAt:  start,
+		})
+	})
+
+	for i, wantStatus := range []int{http.StatusCreated, http.StatusConflict} {
+		req := httptest.NewRequest(http.MethodPost, "/api/chirps/"+chirp.ID.String()+"/reports", strings.NewReader(`{"category": "spam"}`))
+		req.SetPathValue("chirpID", chirp.ID.String())
+		req = requestAs(req, principal{UserID: reporterID, Role: auth.RoleUser})
+		rec := httptest.NewRecorder()
+
+		cfg.handlerReportChirp(rec, req)
+
+		if rec.Code != wantStatus {
+			t.Fatalf("handlerReportChirp() call %d status = %d, want %d", i+1, rec.Code, wantStatus)
+		}
+	}
+}
+
+// fakeReportQueue answers the report queries for a single report, applying
+// ClaimReport and CloseReport only from the states their WHERE clauses
+// allow.
+type fakeReportQueue struct {
+	report database.Report
+}
+
+func (q *fakeReportQueue) register(db *fakeDB) {
+	db.on("GetReport", func(args []driver.Value) fakeResult {
+		return fakeRows(q.report)
+	})
+	db.on("ClaimReport", func(args []driver.Value) fakeResult {
+		if q.report.Status != reportStatusOpen {
+			return fakeResult{}
+		}
+		q.report.Status = reportStatusClaimed
+		q.report.AssigneeID = uuid.NullUUID{UUID: uuid.MustParse(args[1].(string)), Valid: true}
+		q.report.ClaimedAt = sql.NullTime{Time: time.Now().UTC(), Valid: true}
+		return fakeRows(q.report)
+	})
+	db.on("CloseReport", func(args []driver.Value) fakeResult {
+		assigneeID := uuid.MustParse(args[1].(string))
+		if q.report.Status != reportStatusOpen && (q.report.Status != reportStatusClaimed || q.report.AssigneeID.UUID != assigneeID) {
+			return fakeResult{}
+		}
+		q.report.Status = args[0].(string)
+		q.report.AssigneeID = uuid.NullUUID{UUID: assigneeID, Valid: true}
+		q.report.Resolution = args[2].(string)
+		q.report.ClosedAt = sql.NullTime{Time: time.Now().UTC(), Valid: true}
+		return fakeRows(q.report)
+	})
+	db.on("CreateModerationAction", loggedModerationAction)
+}
+
+func TestReportClaimThenClose(t *testing.T) {
+	cfg, db := newFakeDBConfig(t)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	queue := &fakeReportQueue{report: database.Report{
+		ID:         uuid.New(),
+		ReporterID: uuid.New(),
+		ChirpID:    uuid.NullUUID{UUID: uuid.New(), Valid: true},
+		UserID:     uuid.NullUUID{UUID: uuid.New(), Valid: true},
+		Category:   "spam",
+		Status:     reportStatusOpen,
+		CreatedAt:  start,
+		UpdatedAt:  start,
+	}}
+	queue.register(db)
+	report := queue.report
+	claimant := uuid.New()
+	other := uuid.New()
+
+	send := func(handler http.HandlerFunc, moderatorID uuid.UUID, body string) int {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/api/moderation/reports/"+report.ID.String(), strings.NewReader(body))
+		req.SetPathValue("reportID", report.ID.String())
+		req = requestAs(req, principal{UserID: moderatorID, Role: auth.RoleModerator})
+		rec := httptest.NewRecorder()
+
+		handler(rec, req)
+
+		return rec.Code
+	}
+
+	if status := send(cfg.handlerClaimReport, claimant, ""); status != http.StatusOK {
+		t.Fatalf("claim status = %d, want %d", status, http.StatusOK)
+	}
+	if status := send(cfg.handlerClaimReport, other, ""); status != http.StatusConflict {
+		t.Fatalf("second claim status = %d, want %d", status, http.StatusConflict)
+	}
+	if status := send(cfg.handlerResolveReport, other, `{"reason": "removed the chirp"}`); status != http.StatusConflict {
+		t.Fatalf("close by another moderator status = %d, want %d", status, http.StatusConflict)
+	}
+	if status := send(cfg.handlerResolveReport, claimant, `{"reason": "removed the chirp"}`); status != http.StatusOK {
+		t.Fatalf("close by claimant status = %d, want %d", status, http.StatusOK)
+	}
+	if queue.report.Status != reportStatusResolved {
+		t.Fatalf("report status = %q, want %q", queue.report.Status, reportStatusResolved)
+	}
+
+	// Only the claim and the close that went through are logged, each
+	// against the reported chirp and its author.
+	logged := db.committedCalls("CreateModerationAction")
+	if len(logged) != 2 {
+		t.Fatalf("logged %d moderation actions, want 2", len(logged))
+	}
+	for i, want := range [][]driver.Value{
+		{claimant.String(), moderationActionClaimReport, report.UserID.UUID.String(), report.ChirpID.UUID.String(), "", nil, report.ID.String()},
+		{claimant.String(), moderationActionResolveReport, report.UserID.UUID.String(), report.ChirpID.UUID.String(), "removed the chirp", nil, report.ID.String()},
+	} {
+		for j, arg := range want {
+			if logged[i].args[j] != arg {
+				t.Fatalf("moderation action %d arg %d = %v, want %v", i+1, j+1, logged[i].args[j], arg)
+			}
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/glebson1988/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// maxSearchOffset bounds how deep clients can page through search results;
+// past it, they should narrow the query instead.
+const maxSearchOffset = 10000
+
+func (cfg *apiConfig) handlerSearchChirps(w http.ResponseWriter, r *http.Request) {
+	query, err := buildSearchQuery(r.URL.Query().Get("q"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid search query")
+		return
+	}
+
+	limit, err := parsePageLimit(r.URL.Query().Get("limit"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid pagination parameters")
+		return
+	}
+
+	offset := 0
+	if offsetParam := r.URL.Query().Get("offset"); offsetParam != "" {
+		offset, err = strconv.Atoi(offsetParam)
+		if err != nil || offset < 0 || offset > maxSearchOffset {
+			respondWithError(w, http.StatusBadRequest, "Invalid pagination parameters")
+			return
+		}
+	}
+
+	var authorID uuid.NullUUID
+	if authorIDParam := r.URL.Query().Get("author_id"); authorIDParam != "" {
+		id, parseErr := uuid.Parse(authorIDParam)
+		if parseErr != nil {
+			respondWithError(w, http.StatusBadRequest, "Something went wrong")
+			return
+		}
+		authorID = uuid.NullUUID{UUID: id, Valid: true}
+	}
+
+	chirps, err := cfg.db.SearchChirps(r.Context(), database.SearchChirpsParams{
+		Query:     query,
+		AuthorID:  authorID,
+		RowLimit:  int32(limit),
+		RowOffset: int32(offset),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	response := make([]Chirp, 0, len(chirps))
+	for _, chirp := range chirps {
+		response = append(response, databaseChirpToChirp(chirp))
+	}
+
+	if err := cfg.loadChirpDetails(r.Context(), response, viewerID(r)); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// buildSearchQuery translates a search box string into to_tsquery syntax.
+// Every term must match, "quoted phrases" must match in order, and a
+// trailing * turns the last word of a term into a prefix match. Anything
+// that isn't a letter or digit is dropped, so user input can never produce
+// a tsquery syntax error.
+func buildSearchQuery(input string) (string, error) {
+	var terms []string
+	rest := strings.TrimSpace(input)
+	for rest != "" {
+		var segment string
+		if rest[0] == '"' {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				segment, rest = rest[1:], ""
+			} else {
+				segment, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			end := strings.IndexAny(rest, " \t\n\"")
+			if end < 0 {
+				segment, rest = rest, ""
+			} else {
+				segment, rest = rest[:end], rest[end:]
+			}
+		}
+		rest = strings.TrimSpace(rest)
+
+		words := strings.FieldsFunc(strings.ToLower(segment), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		if len(words) == 0 {
+			continue
+		}
+		if strings.HasSuffix(strings.TrimSpace(segment), "*") {
+			words[len(words)-1] += ":*"
+		}
+
+		term := strings.Join(words, " <-> ")
+		if len(words) > 1 {
+			term = "(" + term + ")"
+		}
+		terms = append(terms, term)
+	}
+
+	if len(terms) == 0 {
+		return "", errors.New("empty search query")
+	}
+
+	return strings.Join(terms, " & "), nil
+}
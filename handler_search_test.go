@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBuildSearchQuery(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: "golang", want: "golang"},
+		{input: "Go  Chirpy", want: "go & chirpy"},
+		{input: `"hello world"`, want: "(hello <-> world)"},
+		{input: `chirp* "big day"`, want: "chirp:* & (big <-> day)"},
+		{input: `"unterminated phrase`, want: "(unterminated <-> phrase)"},
+		{input: "it's", want: "(it <-> s)"},
+		{input: "a&b|c:*!", want: "(a <-> b <-> c)"},
+	}
+
+	for _, tt := range tests {
+		got, err := buildSearchQuery(tt.input)
+		if err != nil {
+			t.Fatalf("buildSearchQuery(%q) error = %v", tt.input, err)
+		}
+		if got != tt.want {
+			t.Fatalf("buildSearchQuery(%q) got %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestBuildSearchQueryEmpty(t *testing.T) {
+	for _, input := range []string{"", "   ", `""`, "&|!*"} {
+		if _, err := buildSearchQuery(input); err == nil {
+			t.Fatalf("buildSearchQuery(%q) expected error", input)
+		}
+	}
+}
+
+func TestHandlerSearchChirpsMissingQuery(t *testing.T) {
+	cfg := &apiConfig{}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/chirps/search", nil)
+	rec := httptest.NewRecorder()
+
+	cfg.handlerSearchChirps(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("handlerSearchChirps() status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestHandlerSearchChirpsRejectsLargeOffset(t *testing.T) {
+	cfg := &apiConfig{}
+
+	for _, offset := range []string{"10001", "4294967296"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/chirps/search?q=go&offset="+offset, nil)
+		rec := httptest.NewRecorder()
+
+		cfg.handlerSearchChirps(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("handlerSearchChirps(offset=%s) status = %d, want %d", offset, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
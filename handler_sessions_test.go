@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+func TestNewSessionParams(t *testing.T) {
+	userID := uuid.New()
+	req := httptest.NewRequest(http.MethodPost, "/api/login", nil)
+	req.RemoteAddr = "203.0.113.7:52100"
+	req.Header.Set("User-Agent", strings.Repeat("a", maxUserAgentLength+10))
+
+	got := newSessionParams(req, userID)
+
+	if got.UserID != userID {
+		t.Fatalf("UserID = %v, want %v", got.UserID, userID)
+	}
+	if got.ID == uuid.Nil {
+		t.Fatalf("ID not set")
+	}
+	if got.IpAddress != "203.0.113.7" {
+		t.Fatalf("IpAddress = %q, want %q", got.IpAddress, "203.0.113.7")
+	}
+	if len(got.UserAgent) != maxUserAgentLength {
+		t.Fatalf("len(UserAgent) = %d, want %d", len(got.UserAgent), maxUserAgentLength)
+	}
+}
+
+func TestNewSessionParamsTruncatesUserAgentAtRuneBoundary(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/login", nil)
+	// "a" then two-byte runes, so byte maxUserAgentLength falls mid-rune.
+	req.Header.Set("User-Agent", "a"+strings.Repeat("é", maxUserAgentLength))
+
+	got := newSessionParams(req, uuid.New())
+
+	if !utf8.ValidString(got.UserAgent) {
+		t.Fatalf("UserAgent is not valid UTF-8: %q", got.UserAgent)
+	}
+	if len(got.UserAgent) != maxUserAgentLength-1 {
+		t.Fatalf("len(UserAgent) = %d, want %d", len(got.UserAgent), maxUserAgentLength-1)
+	}
+}
+
+func TestNewSessionParamsDropsInvalidUTF8(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/login", nil)
+	req.Header.Set("User-Agent", "curl\xff/8.0")
+
+	got := newSessionParams(req, uuid.New())
+
+	if got.UserAgent != "curl/8.0" {
+		t.Fatalf("UserAgent = %q, want %q", got.UserAgent, "curl/8.0")
+	}
+}
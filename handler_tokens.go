@@ -1,16 +1,75 @@
 package main
 
 import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
 	"net/http"
 	"time"
 
 	"github.com/glebson1988/chirpy/internal/auth"
+	"github.com/glebson1988/chirpy/internal/database"
+	"github.com/google/uuid"
 )
 
+const refreshTokenTTL = 60 * 24 * time.Hour
+
 type tokenResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// issueRefreshToken makes a new refresh token and stores its digest. Only
+// the returned token can be used to redeem it.
+func (cfg *apiConfig) issueRefreshToken(ctx context.Context, userID, familyID uuid.UUID) (string, error) {
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+
+	id, err := auth.RefreshTokenID(token)
+	if err != nil {
+		return "", err
+	}
+
+	if err := cfg.tokenStore.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+		ID:        id,
+		TokenHash: auth.HashToken(token),
+		ExpiresAt: time.Now().UTC().Add(refreshTokenTTL),
+		UserID:    userID,
+		FamilyID:  familyID,
+	}); err != nil {
+		return "", err
+	}
+
+	return token, nil
 }
 
+// lookupRefreshToken finds a refresh token by its ID and checks the rest of
+// the token against the stored digest.
+func (cfg *apiConfig) lookupRefreshToken(ctx context.Context, token string) (string, database.GetUserFromRefreshTokenRow, error) {
+	id, err := auth.RefreshTokenID(token)
+	if err != nil {
+		return "", database.GetUserFromRefreshTokenRow{}, err
+	}
+
+	tokenInfo, err := cfg.tokenStore.GetUserFromRefreshToken(ctx, id)
+	if err != nil {
+		return "", database.GetUserFromRefreshTokenRow{}, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(auth.HashToken(token)), []byte(tokenInfo.TokenHash)) != 1 {
+		return "", database.GetUserFromRefreshTokenRow{}, sql.ErrNoRows
+	}
+
+	return id, tokenInfo, nil
+}
+
+// handlerRefresh swaps a refresh token for a new access token and a new
+// refresh token in the same family. A refresh token can only be used once:
+// presenting one that has already been revoked means it was stolen or
+// replayed, so the whole family is revoked and the session has to log in
+// again.
 func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 	refreshToken, err := auth.GetBearerToken(r.Header)
 	if err != nil {
@@ -18,25 +77,70 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tokenInfo, err := cfg.tokenStore.GetUserFromRefreshToken(r.Context(), refreshToken)
+	tokenID, tokenInfo, err := cfg.lookupRefreshToken(r.Context(), refreshToken)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
+	if tokenInfo.RevokedAt.Valid {
+		if err := cfg.tokenStore.RevokeRefreshTokenFamily(r.Context(), tokenInfo.FamilyID); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+			return
+		}
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
 	now := time.Now().UTC()
-	if tokenInfo.RevokedAt.Valid || !tokenInfo.ExpiresAt.After(now) {
+	if !tokenInfo.ExpiresAt.After(now) {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Suspending a user revokes their refresh tokens, so this only catches
+	// one issued while the suspension was being applied.
+	if msg := suspensionMessage(tokenInfo.BannedAt, tokenInfo.SuspendedUntil); msg != "" {
+		if err := cfg.tokenStore.RevokeRefreshTokenFamily(r.Context(), tokenInfo.FamilyID); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+			return
+		}
+		respondWithError(w, http.StatusForbidden, msg)
+		return
+	}
+
+	// Two requests racing with the same token both get past the check
+	// above; only one of them revokes it, and the loser is treated as reuse.
+	revoked, err := cfg.tokenStore.RevokeActiveRefreshToken(r.Context(), tokenID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if revoked == 0 {
+		if err := cfg.tokenStore.RevokeRefreshTokenFamily(r.Context(), tokenInfo.FamilyID); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+			return
+		}
 		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	token, err := auth.MakeJWT(tokenInfo.UserID, cfg.tokenSecret, time.Hour)
+	newRefreshToken, err := cfg.issueRefreshToken(r.Context(), tokenInfo.UserID, tokenInfo.FamilyID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, tokenResponse{Token: token})
+	token, err := auth.MakeJWT(tokenInfo.UserID, tokenInfo.Role, auth.SessionScopes, cfg.tokenKeys, time.Hour)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, tokenResponse{
+		Token:        token,
+		RefreshToken: newRefreshToken,
+	})
 }
 
 func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
@@ -46,15 +150,23 @@ func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if _, err := cfg.tokenStore.GetUserFromRefreshToken(r.Context(), refreshToken); err != nil {
+	tokenID, _, err := cfg.lookupRefreshToken(r.Context(), refreshToken)
+	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	if err := cfg.tokenStore.RevokeRefreshToken(r.Context(), refreshToken); err != nil {
+	if err := cfg.tokenStore.RevokeRefreshToken(r.Context(), tokenID); err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// handlerJWKS publishes the public keys access tokens are signed with so
+// other services can verify them without sharing a secret.
+func (cfg *apiConfig) handlerJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondWithJSON(w, http.StatusOK, cfg.tokenKeys.JWKS())
+}
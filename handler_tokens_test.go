@@ -15,43 +15,127 @@ import (
 	"github.com/google/uuid"
 )
 
+const (
+	testRefreshToken   = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	testRefreshTokenID = "0123456789abcdef"
+)
+
+var testRefreshTokenHash = auth.HashToken(testRefreshToken)
+
+func newTestKeyring(t *testing.T) *auth.Keyring {
+	t.Helper()
+
+	keys, err := auth.NewKeyring("http://localhost:8080", auth.KeyFromSecret("test-secret"))
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	return keys
+}
+
 type stubDB struct {
-	getUserFromRefreshToken func(ctx context.Context, token string) (database.GetUserFromRefreshTokenRow, error)
-	revokeRefreshToken      func(ctx context.Context, token string) error
+	createRefreshToken       func(ctx context.Context, arg database.CreateRefreshTokenParams) error
+	getUserFromRefreshToken  func(ctx context.Context, id string) (database.GetUserFromRefreshTokenRow, error)
+	revokeRefreshToken       func(ctx context.Context, id string) error
+	revokeActiveRefreshToken func(ctx context.Context, id string) (int64, error)
+	revokeRefreshTokenFamily func(ctx context.Context, familyID uuid.UUID) error
+	getPersonalAccessToken   func(ctx context.Context, tokenHash string) (database.PersonalAccessToken, error)
+	touchPersonalAccessToken func(ctx context.Context, id uuid.UUID) error
+	getUserStanding          func(ctx context.Context, id uuid.UUID) (database.GetUserStandingRow, error)
+}
+
+func (s *stubDB) CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) error {
+	if s.createRefreshToken == nil {
+		return errors.New("not implemented")
+	}
+	return s.createRefreshToken(ctx, arg)
 }
 
-func (s *stubDB) GetUserFromRefreshToken(ctx context.Context, token string) (database.GetUserFromRefreshTokenRow, error) {
+func (s *stubDB) GetUserFromRefreshToken(ctx context.Context, id string) (database.GetUserFromRefreshTokenRow, error) {
 	if s.getUserFromRefreshToken == nil {
 		return database.GetUserFromRefreshTokenRow{}, errors.New("not implemented")
 	}
-	return s.getUserFromRefreshToken(ctx, token)
+	return s.getUserFromRefreshToken(ctx, id)
 }
 
-func (s *stubDB) RevokeRefreshToken(ctx context.Context, token string) error {
+func (s *stubDB) RevokeRefreshToken(ctx context.Context, id string) error {
 	if s.revokeRefreshToken == nil {
 		return errors.New("not implemented")
 	}
-	return s.revokeRefreshToken(ctx, token)
+	return s.revokeRefreshToken(ctx, id)
+}
+
+func (s *stubDB) RevokeActiveRefreshToken(ctx context.Context, id string) (int64, error) {
+	if s.revokeActiveRefreshToken == nil {
+		return 0, errors.New("not implemented")
+	}
+	return s.revokeActiveRefreshToken(ctx, id)
+}
+
+func (s *stubDB) RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	if s.revokeRefreshTokenFamily == nil {
+		return errors.New("not implemented")
+	}
+	return s.revokeRefreshTokenFamily(ctx, familyID)
+}
+
+func (s *stubDB) GetPersonalAccessToken(ctx context.Context, tokenHash string) (database.PersonalAccessToken, error) {
+	if s.getPersonalAccessToken == nil {
+		return database.PersonalAccessToken{}, errors.New("not implemented")
+	}
+	return s.getPersonalAccessToken(ctx, tokenHash)
+}
+
+func (s *stubDB) TouchPersonalAccessToken(ctx context.Context, id uuid.UUID) error {
+	if s.touchPersonalAccessToken == nil {
+		return errors.New("not implemented")
+	}
+	return s.touchPersonalAccessToken(ctx, id)
+}
+
+// GetUserStanding treats every user as a plain user in good standing
+// unless the test says otherwise.
+func (s *stubDB) GetUserStanding(ctx context.Context, id uuid.UUID) (database.GetUserStandingRow, error) {
+	if s.getUserStanding == nil {
+		return database.GetUserStandingRow{Role: auth.RoleUser}, nil
+	}
+	return s.getUserStanding(ctx, id)
 }
 
 func TestHandlerRefreshSuccess(t *testing.T) {
 	userID := uuid.New()
+	familyID := uuid.New()
+	revokedOld := false
+	var created database.CreateRefreshTokenParams
 	db := &stubDB{
-		getUserFromRefreshToken: func(ctx context.Context, token string) (database.GetUserFromRefreshTokenRow, error) {
+		getUserFromRefreshToken: func(ctx context.Context, id string) (database.GetUserFromRefreshTokenRow, error) {
 			return database.GetUserFromRefreshTokenRow{
 				UserID:    userID,
 				ExpiresAt: time.Now().UTC().Add(time.Minute),
+				TokenHash: testRefreshTokenHash,
 				RevokedAt: sql.NullTime{Valid: false},
+				FamilyID:  familyID,
+				Role:      auth.RoleAdmin,
 			}, nil
 		},
+		revokeActiveRefreshToken: func(ctx context.Context, id string) (int64, error) {
+			if id != testRefreshTokenID {
+				return 0, errors.New("unexpected token")
+			}
+			revokedOld = true
+			return 1, nil
+		},
+		createRefreshToken: func(ctx context.Context, arg database.CreateRefreshTokenParams) error {
+			created = arg
+			return nil
+		},
 	}
 	cfg := &apiConfig{
-		tokenSecret: "test-secret",
-		tokenStore:  db,
+		tokenKeys:  newTestKeyring(t),
+		tokenStore: db,
 	}
 
 	req := httptest.NewRequest(http.MethodPost, "/api/refresh", nil)
-	req.Header.Set("Authorization", "Bearer refresh-token")
+	req.Header.Set("Authorization", "Bearer "+testRefreshToken)
 	rec := httptest.NewRecorder()
 
 	cfg.handlerRefresh(rec, req)
@@ -61,7 +145,8 @@ func TestHandlerRefreshSuccess(t *testing.T) {
 	}
 
 	var payload struct {
-		Token string `json:"token"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
 	}
 	if err := json.NewDecoder(rec.Body).Decode(&payload); err != nil {
 		t.Fatalf("handlerRefresh() decode error = %v", err)
@@ -69,33 +154,43 @@ func TestHandlerRefreshSuccess(t *testing.T) {
 	if payload.Token == "" {
 		t.Fatalf("handlerRefresh() returned empty token")
 	}
+	if !revokedOld {
+		t.Fatalf("handlerRefresh() did not revoke the old refresh token")
+	}
+	if payload.RefreshToken == "" || payload.RefreshToken == testRefreshToken {
+		t.Fatalf("handlerRefresh() refresh_token = %q, want a new token", payload.RefreshToken)
+	}
+	if created.TokenHash != auth.HashToken(payload.RefreshToken) || created.FamilyID != familyID || created.UserID != userID {
+		t.Fatalf("handlerRefresh() stored %+v, want token %q in family %v", created, payload.RefreshToken, familyID)
+	}
 
-	gotID, err := auth.ValidateJWT(payload.Token, cfg.tokenSecret)
+	got, err := auth.ValidateJWT(payload.Token, cfg.tokenKeys)
 	if err != nil {
 		t.Fatalf("ValidateJWT() error = %v", err)
 	}
-	if gotID != userID {
-		t.Fatalf("ValidateJWT() got %v, want %v", gotID, userID)
+	if got.UserID != userID || got.Role != auth.RoleAdmin {
+		t.Fatalf("ValidateJWT() got %v (%s), want %v (%s)", got.UserID, got.Role, userID, auth.RoleAdmin)
 	}
 }
 
 func TestHandlerRefreshExpired(t *testing.T) {
 	db := &stubDB{
-		getUserFromRefreshToken: func(ctx context.Context, token string) (database.GetUserFromRefreshTokenRow, error) {
+		getUserFromRefreshToken: func(ctx context.Context, id string) (database.GetUserFromRefreshTokenRow, error) {
 			return database.GetUserFromRefreshTokenRow{
 				UserID:    uuid.New(),
 				ExpiresAt: time.Now().UTC().Add(-time.Minute),
+				TokenHash: testRefreshTokenHash,
 				RevokedAt: sql.NullTime{Valid: false},
 			}, nil
 		},
 	}
 	cfg := &apiConfig{
-		tokenSecret: "test-secret",
-		tokenStore:  db,
+		tokenKeys:  newTestKeyring(t),
+		tokenStore: db,
 	}
 
 	req := httptest.NewRequest(http.MethodPost, "/api/refresh", nil)
-	req.Header.Set("Authorization", "Bearer refresh-token")
+	req.Header.Set("Authorization", "Bearer "+testRefreshToken)
 	rec := httptest.NewRecorder()
 
 	cfg.handlerRefresh(rec, req)
@@ -106,22 +201,33 @@ func TestHandlerRefreshExpired(t *testing.T) {
 }
 
 func TestHandlerRefreshRevoked(t *testing.T) {
+	familyID := uuid.New()
+	revokedFamily := false
 	db := &stubDB{
-		getUserFromRefreshToken: func(ctx context.Context, token string) (database.GetUserFromRefreshTokenRow, error) {
+		getUserFromRefreshToken: func(ctx context.Context, id string) (database.GetUserFromRefreshTokenRow, error) {
 			return database.GetUserFromRefreshTokenRow{
 				UserID:    uuid.New(),
 				ExpiresAt: time.Now().UTC().Add(time.Minute),
+				TokenHash: testRefreshTokenHash,
 				RevokedAt: sql.NullTime{Valid: true, Time: time.Now().UTC()},
+				FamilyID:  familyID,
 			}, nil
 		},
+		revokeRefreshTokenFamily: func(ctx context.Context, id uuid.UUID) error {
+			if id != familyID {
+				return errors.New("unexpected family")
+			}
+			revokedFamily = true
+			return nil
+		},
 	}
 	cfg := &apiConfig{
-		tokenSecret: "test-secret",
-		tokenStore:  db,
+		tokenKeys:  newTestKeyring(t),
+		tokenStore: db,
 	}
 
 	req := httptest.NewRequest(http.MethodPost, "/api/refresh", nil)
-	req.Header.Set("Authorization", "Bearer refresh-token")
+	req.Header.Set("Authorization", "Bearer "+testRefreshToken)
 	rec := httptest.NewRecorder()
 
 	cfg.handlerRefresh(rec, req)
@@ -129,20 +235,64 @@ func TestHandlerRefreshRevoked(t *testing.T) {
 	if rec.Code != http.StatusUnauthorized {
 		t.Fatalf("handlerRefresh() status = %d, want %d", rec.Code, http.StatusUnauthorized)
 	}
+	if !revokedFamily {
+		t.Fatalf("handlerRefresh() did not revoke the token family")
+	}
+}
+
+func TestHandlerRefreshConcurrentReuse(t *testing.T) {
+	familyID := uuid.New()
+	revokedFamily := false
+	db := &stubDB{
+		getUserFromRefreshToken: func(ctx context.Context, id string) (database.GetUserFromRefreshTokenRow, error) {
+			return database.GetUserFromRefreshTokenRow{
+				UserID:    uuid.New(),
+				ExpiresAt: time.Now().UTC().Add(time.Minute),
+				TokenHash: testRefreshTokenHash,
+				FamilyID:  familyID,
+			}, nil
+		},
+		// Another request revoked the token between the lookup and here.
+		revokeActiveRefreshToken: func(ctx context.Context, id string) (int64, error) {
+			return 0, nil
+		},
+		revokeRefreshTokenFamily: func(ctx context.Context, id uuid.UUID) error {
+			revokedFamily = id == familyID
+			return nil
+		},
+	}
+	cfg := &apiConfig{
+		tokenKeys:  newTestKeyring(t),
+		tokenStore: db,
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/refresh", nil)
+	req.Header.Set("Authorization", "Bearer "+testRefreshToken)
+	rec := httptest.NewRecorder()
+
+	cfg.handlerRefresh(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("handlerRefresh() status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if !revokedFamily {
+		t.Fatalf("handlerRefresh() did not revoke the token family")
+	}
 }
 
 func TestHandlerRevokeSuccess(t *testing.T) {
 	called := false
 	db := &stubDB{
-		getUserFromRefreshToken: func(ctx context.Context, token string) (database.GetUserFromRefreshTokenRow, error) {
+		getUserFromRefreshToken: func(ctx context.Context, id string) (database.GetUserFromRefreshTokenRow, error) {
 			return database.GetUserFromRefreshTokenRow{
 				UserID:    uuid.New(),
 				ExpiresAt: time.Now().UTC().Add(time.Minute),
+				TokenHash: testRefreshTokenHash,
 				RevokedAt: sql.NullTime{Valid: false},
 			}, nil
 		},
-		revokeRefreshToken: func(ctx context.Context, token string) error {
-			if token != "refresh-token" {
+		revokeRefreshToken: func(ctx context.Context, id string) error {
+			if id != testRefreshTokenID {
 				return errors.New("unexpected token")
 			}
 			called = true
@@ -150,12 +300,12 @@ func TestHandlerRevokeSuccess(t *testing.T) {
 		},
 	}
 	cfg := &apiConfig{
-		tokenSecret: "test-secret",
-		tokenStore:  db,
+		tokenKeys:  newTestKeyring(t),
+		tokenStore: db,
 	}
 
 	req := httptest.NewRequest(http.MethodPost, "/api/revoke", nil)
-	req.Header.Set("Authorization", "Bearer refresh-token")
+	req.Header.Set("Authorization", "Bearer "+testRefreshToken)
 	rec := httptest.NewRecorder()
 
 	cfg.handlerRevoke(rec, req)
@@ -170,17 +320,17 @@ func TestHandlerRevokeSuccess(t *testing.T) {
 
 func TestHandlerRevokeMissingToken(t *testing.T) {
 	db := &stubDB{
-		getUserFromRefreshToken: func(ctx context.Context, token string) (database.GetUserFromRefreshTokenRow, error) {
+		getUserFromRefreshToken: func(ctx context.Context, id string) (database.GetUserFromRefreshTokenRow, error) {
 			return database.GetUserFromRefreshTokenRow{}, errors.New("not found")
 		},
 	}
 	cfg := &apiConfig{
-		tokenSecret: "test-secret",
-		tokenStore:  db,
+		tokenKeys:  newTestKeyring(t),
+		tokenStore: db,
 	}
 
 	req := httptest.NewRequest(http.MethodPost, "/api/revoke", nil)
-	req.Header.Set("Authorization", "Bearer refresh-token")
+	req.Header.Set("Authorization", "Bearer "+testRefreshToken)
 	rec := httptest.NewRecorder()
 
 	cfg.handlerRevoke(rec, req)
@@ -189,3 +339,52 @@ func TestHandlerRevokeMissingToken(t *testing.T) {
 		t.Fatalf("handlerRevoke() status = %d, want %d", rec.Code, http.StatusUnauthorized)
 	}
 }
+
+func TestHandlerRefreshRejectsMismatchedHash(t *testing.T) {
+	db := &stubDB{
+		getUserFromRefreshToken: func(ctx context.Context, id string) (database.GetUserFromRefreshTokenRow, error) {
+			return database.GetUserFromRefreshTokenRow{
+				UserID:    uuid.New(),
+				ExpiresAt: time.Now().UTC().Add(time.Minute),
+				TokenHash: testRefreshTokenHash,
+			}, nil
+		},
+	}
+	cfg := &apiConfig{
+		tokenKeys:  newTestKeyring(t),
+		tokenStore: db,
+	}
+
+	// Same ID prefix as testRefreshToken, different secret part.
+	forged := testRefreshTokenID + "ffffffffffffffffffffffffffffffffffffffffffffffff"
+	req := httptest.NewRequest(http.MethodPost, "/api/refresh", nil)
+	req.Header.Set("Authorization", "Bearer "+forged)
+	rec := httptest.NewRecorder()
+
+	cfg.handlerRefresh(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("handlerRefresh() status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestHandlerJWKS(t *testing.T) {
+	cfg := &apiConfig{tokenKeys: newTestKeyring(t)}
+
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	rec := httptest.NewRecorder()
+
+	cfg.handlerJWKS(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	var jwks auth.JWKS
+	if err := json.NewDecoder(rec.Body).Decode(&jwks); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(jwks.Keys) != 1 || jwks.Keys[0].KeyID == "" || jwks.Keys[0].Algorithm != "EdDSA" {
+		t.Fatalf("unexpected JWKS %+v", jwks)
+	}
+}
@@ -3,8 +3,12 @@ package main
 import (
 	"database/sql"
 	"encoding/json"
+	"log"
 	"net/http"
+	"net/mail"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/glebson1988/chirpy/internal/auth"
 	"github.com/glebson1988/chirpy/internal/database"
@@ -12,21 +16,32 @@ import (
 )
 
 type User struct {
-	ID          uuid.UUID `json:"id"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	Email       string    `json:"email"`
-	IsChirpyRed bool      `json:"is_chirpy_red"`
+	ID            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	Handle        string    `json:"handle,omitempty"`
+	DisplayName   string    `json:"display_name"`
+	Bio           string    `json:"bio"`
+	AvatarURL     string    `json:"avatar_url"`
+	IsChirpyRed   bool      `json:"is_chirpy_red"`
+	MFAEnabled    bool      `json:"mfa_enabled"`
+	Role          string    `json:"role"`
 }
 
 type UserWithToken struct {
-	ID           uuid.UUID `json:"id"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	Email        string    `json:"email"`
-	IsChirpyRed  bool      `json:"is_chirpy_red"`
-	Token        string    `json:"token"`
-	RefreshToken string    `json:"refresh_token"`
+	ID            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	Handle        string    `json:"handle,omitempty"`
+	IsChirpyRed   bool      `json:"is_chirpy_red"`
+	MFAEnabled    bool      `json:"mfa_enabled"`
+	Role          string    `json:"role"`
+	Token         string    `json:"token"`
+	RefreshToken  string    `json:"refresh_token"`
 }
 
 func isChirpyRedValue(value sql.NullBool) bool {
@@ -36,10 +51,40 @@ func isChirpyRedValue(value sql.NullBool) bool {
 	return false
 }
 
+func databaseUserToUser(user database.User) User {
+	return User{
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		Handle:        user.Handle.String,
+		DisplayName:   user.DisplayName,
+		Bio:           user.Bio,
+		AvatarURL:     user.AvatarUrl,
+		IsChirpyRed:   isChirpyRedValue(user.IsChirpyRed),
+		MFAEnabled:    user.TotpEnabledAt.Valid,
+		Role:          user.Role,
+	}
+}
+
+// normalizeEmail checks that email is a bare address, such as
+// user@example.com, and lowercases it so that one address can't be
+// registered twice in different cases.
+func normalizeEmail(email string) (string, bool) {
+	email = strings.TrimSpace(email)
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Name != "" || addr.Address != email {
+		return "", false
+	}
+	return strings.ToLower(addr.Address), true
+}
+
 func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		Handle   string `json:"handle"`
 	}
 
 	decoder := json.NewDecoder(r.Body)
@@ -54,6 +99,22 @@ func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	email, ok := normalizeEmail(params.Email)
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Invalid email address")
+		return
+	}
+
+	var handle sql.NullString
+	if params.Handle != "" {
+		normalized, ok := normalizeHandle(params.Handle)
+		if !ok {
+			respondWithError(w, http.StatusBadRequest, "Handles must be 3-30 letters, digits or underscores")
+			return
+		}
+		handle = sql.NullString{String: normalized, Valid: true}
+	}
+
 	hashedPassword, err := auth.HashPassword(params.Password)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
@@ -61,76 +122,186 @@ func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request)
 	}
 
 	user, err := cfg.db.CreateUser(r.Context(), database.CreateUserParams{
-		Email:          params.Email,
+		Email:          email,
 		HashedPassword: hashedPassword,
+		Handle:         handle,
 	})
 	if err != nil {
+		if isUniqueViolation(err, "users_handle_key") {
+			respondWithError(w, http.StatusConflict, "Handle is already taken")
+			return
+		}
 		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
 		return
 	}
 
-	respondWithJSON(w, http.StatusCreated, User{
-		ID:          user.ID,
-		CreatedAt:   user.CreatedAt,
-		UpdatedAt:   user.UpdatedAt,
-		Email:       user.Email,
-		IsChirpyRed: isChirpyRedValue(user.IsChirpyRed),
-	})
+	// The account exists either way; the user can ask for another email.
+	if err := cfg.sendVerificationEmail(r.Context(), user); err != nil {
+		log.Printf("Failed to send verification email to user %s: %v", user.ID, err)
+	}
+
+	respondWithJSON(w, http.StatusCreated, databaseUserToUser(user))
 }
 
-func (cfg *apiConfig) handlerUpdateUser(w http.ResponseWriter, r *http.Request) {
+// handlerPatchUser changes only the fields present in the request body.
+// Sending an empty string clears display_name, bio or avatar_url; a handle
+// can be changed but not removed. Changing the email or password requires
+// the current password, and a new password revokes every refresh token,
+// the caller's own included, and every personal access token.
+func (cfg *apiConfig) handlerPatchUser(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email           *string `json:"email"`
+		Password        *string `json:"password"`
+		CurrentPassword string  `json:"current_password"`
+		Handle          *string `json:"handle"`
+		DisplayName     *string `json:"display_name"`
+		Bio             *string `json:"bio"`
+		AvatarURL       *string `json:"avatar_url"`
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+	decoder := json.NewDecoder(r.Body)
+	var params parameters
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Something went wrong")
 		return
 	}
 
-	userID, err := auth.ValidateJWT(token, cfg.tokenSecret)
-	if err != nil {
+	p, ok := principalFromContext(r.Context())
+	if !ok {
 		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
+	userID := p.UserID
 
-	decoder := json.NewDecoder(r.Body)
-	var params parameters
-	if err := decoder.Decode(&params); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Something went wrong")
+	// Profile fields are fair game for a personal access token; sign-in
+	// credentials are not.
+	if (params.Email != nil || params.Password != nil) && !auth.HasScope(p.Scopes, auth.ScopeAccount) {
+		respondWithAuthError(w, errInsufficientScope)
 		return
 	}
 
-	if params.Password == "" || params.Email == "" {
-		respondWithError(w, http.StatusBadRequest, "Something went wrong")
-		return
+	update := database.PatchUserParams{ID: userID}
+	if params.Email != nil {
+		if *params.Email == "" {
+			respondWithError(w, http.StatusBadRequest, "Email can't be empty")
+			return
+		}
+		email, ok := normalizeEmail(*params.Email)
+		if !ok {
+			respondWithError(w, http.StatusBadRequest, "Invalid email address")
+			return
+		}
+		update.Email = sql.NullString{String: email, Valid: true}
+	}
+	if params.Password != nil {
+		if *params.Password == "" {
+			respondWithError(w, http.StatusBadRequest, "Password can't be empty")
+			return
+		}
+		hashedPassword, err := auth.HashPassword(*params.Password)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+			return
+		}
+		update.HashedPassword = sql.NullString{String: hashedPassword, Valid: true}
+	}
+	if params.Handle != nil {
+		handle, ok := normalizeHandle(*params.Handle)
+		if !ok {
+			respondWithError(w, http.StatusBadRequest, "Handles must be 3-30 letters, digits or underscores")
+			return
+		}
+		update.Handle = sql.NullString{String: handle, Valid: true}
+	}
+	if params.DisplayName != nil {
+		if utf8.RuneCountInString(*params.DisplayName) > maxDisplayNameLength {
+			respondWithError(w, http.StatusBadRequest, "Display name is too long")
+			return
+		}
+		update.DisplayName = sql.NullString{String: *params.DisplayName, Valid: true}
+	}
+	if params.Bio != nil {
+		if utf8.RuneCountInString(*params.Bio) > maxBioLength {
+			respondWithError(w, http.StatusBadRequest, "Bio is too long")
+			return
+		}
+		update.Bio = sql.NullString{String: *params.Bio, Valid: true}
+	}
+	if params.AvatarURL != nil {
+		if !validAvatarURL(*params.AvatarURL) {
+			respondWithError(w, http.StatusBadRequest, "Avatar URL must be an http or https URL")
+			return
+		}
+		update.AvatarUrl = sql.NullString{String: *params.AvatarURL, Valid: true}
 	}
 
-	hashedPassword, err := auth.HashPassword(params.Password)
+	if update.Email.Valid || update.HashedPassword.Valid {
+		current, err := cfg.db.GetUserByID(r.Context(), userID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				respondWithError(w, http.StatusNotFound, "Something went wrong")
+				return
+			}
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+			return
+		}
+
+		ok, err := auth.CheckPasswordHash(params.CurrentPassword, current.HashedPassword)
+		if err != nil || !ok {
+			respondWithError(w, http.StatusUnauthorized, "Current password is incorrect")
+			return
+		}
+	}
+
+	tx, err := cfg.dbConn.BeginTx(r.Context(), nil)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
 		return
 	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
 
-	user, err := cfg.db.UpdateUser(r.Context(), database.UpdateUserParams{
-		ID:             userID,
-		Email:          params.Email,
-		HashedPassword: hashedPassword,
-	})
+	user, err := qtx.PatchUser(r.Context(), update)
 	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Something went wrong")
+			return
+		}
+		if isUniqueViolation(err, "users_email_key") {
+			respondWithError(w, http.StatusConflict, "Email is already in use")
+			return
+		}
+		if isUniqueViolation(err, "users_handle_key") {
+			respondWithError(w, http.StatusConflict, "Handle is already taken")
+			return
+		}
 		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, User{
-		ID:          user.ID,
-		CreatedAt:   user.CreatedAt,
-		UpdatedAt:   user.UpdatedAt,
-		Email:       user.Email,
-		IsChirpyRed: isChirpyRedValue(user.IsChirpyRed),
-	})
+	if update.HashedPassword.Valid {
+		if err := qtx.RevokeUserRefreshTokens(r.Context(), userID); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+			return
+		}
+		if err := qtx.RevokeUserPersonalAccessTokens(r.Context(), userID); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	if update.Email.Valid && !user.EmailVerifiedAt.Valid {
+		if err := cfg.sendVerificationEmail(r.Context(), user); err != nil {
+			log.Printf("Failed to send verification email to user %s: %v", user.ID, err)
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, databaseUserToUser(user))
 }
 
 func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
@@ -158,35 +329,79 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := auth.MakeJWT(user.ID, cfg.tokenSecret, time.Hour)
+	if msg := suspensionMessage(user.BannedAt, user.SuspendedUntil); msg != "" {
+		respondWithError(w, http.StatusForbidden, msg)
+		return
+	}
+
+	// With two-factor authentication on, the password alone only earns a
+	// short-lived challenge token to exchange at /api/login/mfa.
+	if user.TotpEnabledAt.Valid {
+		challengeID := uuid.New()
+		if err := cfg.db.CreateMFAChallenge(r.Context(), database.CreateMFAChallengeParams{
+			ID:        challengeID,
+			UserID:    user.ID,
+			ExpiresAt: time.Now().UTC().Add(mfaChallengeTTL),
+		}); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+			return
+		}
+
+		mfaToken, err := auth.MakePurposeJWT(user.ID, challengeID, mfaChallengePurpose, cfg.tokenKeys, mfaChallengeTTL)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+			return
+		}
+		respondWithJSON(w, http.StatusOK, MFAChallenge{
+			MFARequired: true,
+			MFAToken:    mfaToken,
+		})
+		return
+	}
+
+	cfg.respondWithLogin(w, r, user)
+}
+
+// respondWithLogin starts a new session for a user who has proved who they
+// are and sends back their access and refresh tokens. Every way of logging
+// in ends here, so it also turns away suspended users.
+func (cfg *apiConfig) respondWithLogin(w http.ResponseWriter, r *http.Request, user database.User) {
+	if msg := suspensionMessage(user.BannedAt, user.SuspendedUntil); msg != "" {
+		respondWithError(w, http.StatusForbidden, msg)
+		return
+	}
+
+	token, err := auth.MakeJWT(user.ID, user.Role, auth.SessionScopes, cfg.tokenKeys, time.Hour)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
 		return
 	}
 
-	refreshToken, err := auth.MakeRefreshToken()
-	if err != nil {
+	// Each login starts a new session, whose ID is the family every
+	// refresh token rotated from this one shares.
+	session := newSessionParams(r, user.ID)
+	if err := cfg.db.CreateSession(r.Context(), session); err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
 		return
 	}
 
-	expiresAt := time.Now().UTC().Add(60 * 24 * time.Hour)
-	if err := cfg.db.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
-		Token:     refreshToken,
-		ExpiresAt: expiresAt,
-		UserID:    user.ID,
-	}); err != nil {
+	refreshToken, err := cfg.issueRefreshToken(r.Context(), user.ID, session.ID)
+	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
 		return
 	}
 
 	respondWithJSON(w, http.StatusOK, UserWithToken{
-		ID:           user.ID,
-		CreatedAt:    user.CreatedAt,
-		UpdatedAt:    user.UpdatedAt,
-		Email:        user.Email,
-		IsChirpyRed:  isChirpyRedValue(user.IsChirpyRed),
-		Token:        token,
-		RefreshToken: refreshToken,
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		Handle:        user.Handle.String,
+		IsChirpyRed:   isChirpyRedValue(user.IsChirpyRed),
+		MFAEnabled:    user.TotpEnabledAt.Valid,
+		Role:          user.Role,
+		Token:         token,
+		RefreshToken:  refreshToken,
 	})
 }
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"database/sql/driver"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebson1988/chirpy/internal/auth"
+	"github.com/glebson1988/chirpy/internal/database"
+	"github.com/glebson1988/chirpy/internal/mailer"
+	"github.com/google/uuid"
+)
+
+func TestHandlerPatchUserRejectsInvalidFields(t *testing.T) {
+	cfg := &apiConfig{tokenKeys: newTestKeyring(t), tokenStore: &stubDB{}}
+
+	token, err := auth.MakeJWT(uuid.New(), auth.RoleUser, auth.SessionScopes, cfg.tokenKeys, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT: %v", err)
+	}
+
+	for _, body := range []string{
+		`{"password": ""}`,
+		`{"email": ""}`,
+		`{"email": "not an email"}`,
+		`{"email": "Someone <someone@example.com>"}`,
+		`{"handle": "no spaces"}`,
+		`{"avatar_url": "ftp://example.com/me.png"}`,
+	} {
+		req := httptest.NewRequest(http.MethodPatch, "/api/users/me", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+
+		cfg.middlewareAuth(auth.ScopeUsersWrite, http.HandlerFunc(cfg.handlerPatchUser)).ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("handlerPatchUser(%s) status = %d, want %d", body, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestHandlerPatchUserRequiresAuth(t *testing.T) {
+	cfg := &apiConfig{tokenKeys: newTestKeyring(t)}
+
+	req := httptest.NewRequest(http.MethodPatch, "/api/users/me", strings.NewReader(`{"bio": "hi"}`))
+	rec := httptest.NewRecorder()
+
+	cfg.middlewareAuth(auth.ScopeUsersWrite, http.HandlerFunc(cfg.handlerPatchUser)).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestHandlerDeleteUserRequiresAuth(t *testing.T) {
+	cfg := &apiConfig{tokenKeys: newTestKeyring(t)}
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/users/me", strings.NewReader(`{"password": "pw"}`))
+	rec := httptest.NewRecorder()
+
+	cfg.middlewareAuth(auth.ScopeAccount, http.HandlerFunc(cfg.handlerDeleteUser)).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestHandlerCreateUserValidatesEmail(t *testing.T) {
+	tests := []struct {
+		name       string
+		email      string
+		wantStatus int
+		wantStored string
+	}{
+		{name: "plain", email: "user@example.com", wantStatus: http.StatusCreated, wantStored: "user@example.com"},
+		{name: "mixed case", email: " User@Example.COM ", wantStatus: http.StatusCreated, wantStored: "user@example.com"},
+		{name: "no domain", email: "user", wantStatus: http.StatusBadRequest},
+		{name: "display name", email: "User <user@example.com>", wantStatus: http.StatusBadRequest},
+		{name: "two addresses", email: "a@example.com, b@example.com", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, db := newFakeDBConfig(t)
+			cfg.mailer = mailer.NewLogMailer(io.Discard)
+			db.on("CreateUser", func(args []driver.Value) fakeResult {
+				return fakeRows(database.User{ID: uuid.New(), Email: args[0].(string), Role: auth.RoleUser})
+			})
+
+			body := `{"email": "` + tt.email + `", "password": "hunter2"}`
+			req := httptest.NewRequest(http.MethodPost, "/api/users", strings.NewReader(body))
+			rec := httptest.NewRecorder()
+
+			cfg.handlerCreateUser(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("handlerCreateUser(%q) status = %d, want %d", tt.email, rec.Code, tt.wantStatus)
+			}
+			calls := db.calls("CreateUser")
+			if tt.wantStatus != http.StatusCreated {
+				if len(calls) != 0 || len(db.calls("CreateEmailVerificationToken")) != 0 {
+					t.Fatalf("handlerCreateUser(%q) created a user or verification token", tt.email)
+				}
+				return
+			}
+			if len(calls) != 1 {
+				t.Fatalf("handlerCreateUser(%q) ran CreateUser %d times, want 1", tt.email, len(calls))
+			}
+			if calls[0].args[0] != tt.wantStored {
+				t.Fatalf("handlerCreateUser(%q) stored %v, want %q", tt.email, calls[0].args[0], tt.wantStored)
+			}
+		})
+	}
+}
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/glebson1988/chirpy/internal/auth"
+	"github.com/glebson1988/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	webAuthnRegisterPurpose = "register"
+	webAuthnLoginPurpose    = "login"
+	webAuthnChallengeTTL    = 5 * time.Minute
+	maxPasskeyNameLength    = 64
+)
+
+// base64URL is binary data carried in JSON the way browsers encode it for
+// WebAuthn: unpadded base64url.
+type base64URL []byte
+
+func (b base64URL) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func (b *base64URL) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	*b = decoded
+	return nil
+}
+
+// Passkey is a registered WebAuthn credential as shown to its owner.
+type Passkey struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+type webAuthnCredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+type webAuthnCredentialDescriptor struct {
+	Type string    `json:"type"`
+	ID   base64URL `json:"id"`
+}
+
+// WebAuthnRegistrationOptions is passed, as publicKey, to
+// navigator.credentials.create().
+type WebAuthnRegistrationOptions struct {
+	ChallengeID uuid.UUID `json:"challenge_id"`
+	PublicKey   struct {
+		Challenge base64URL `json:"challenge"`
+		RP        struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"rp"`
+		User struct {
+			ID          base64URL `json:"id"`
+			Name        string    `json:"name"`
+			DisplayName string    `json:"displayName"`
+		} `json:"user"`
+		PubKeyCredParams       []webAuthnCredentialParameter `json:"pubKeyCredParams"`
+		AuthenticatorSelection struct {
+			ResidentKey      string `json:"residentKey"`
+			UserVerification string `json:"userVerification"`
+		} `json:"authenticatorSelection"`
+		ExcludeCredentials []webAuthnCredentialDescriptor `json:"excludeCredentials"`
+		Attestation        string                         `json:"attestation"`
+		Timeout            int64                          `json:"timeout"`
+	} `json:"public_key"`
+}
+
+// WebAuthnLoginOptions is passed, as publicKey, to
+// navigator.credentials.get().
+type WebAuthnLoginOptions struct {
+	ChallengeID uuid.UUID `json:"challenge_id"`
+	PublicKey   struct {
+		Challenge        base64URL `json:"challenge"`
+		RPID             string    `json:"rpId"`
+		UserVerification string    `json:"userVerification"`
+		Timeout          int64     `json:"timeout"`
+	} `json:"public_key"`
+}
+
+func databasePasskeyToPasskey(credential database.WebauthnCredential) Passkey {
+	passkey := Passkey{
+		ID:        credential.ID,
+		Name:      credential.Name,
+		CreatedAt: credential.CreatedAt,
+	}
+	if credential.LastUsedAt.Valid {
+		passkey.LastUsedAt = &credential.LastUsedAt.Time
+	}
+	return passkey
+}
+
+// newWebAuthnChallenge stores a fresh challenge for a ceremony. Expired
+// challenges are swept here since abandoned ceremonies never consume theirs.
+func (cfg *apiConfig) newWebAuthnChallenge(ctx context.Context, userID uuid.NullUUID, purpose string) (uuid.UUID, []byte, error) {
+	if err := cfg.db.DeleteExpiredWebAuthnChallenges(ctx); err != nil {
+		return uuid.Nil, nil, err
+	}
+
+	challenge, err := auth.NewWebAuthnChallenge()
+	if err != nil {
+		return uuid.Nil, nil, err
+	}
+
+	id := uuid.New()
+	if err := cfg.db.CreateWebAuthnChallenge(ctx, database.CreateWebAuthnChallengeParams{
+		ID:        id,
+		UserID:    userID,
+		Purpose:   purpose,
+		Challenge: challenge,
+		ExpiresAt: time.Now().UTC().Add(webAuthnChallengeTTL),
+	}); err != nil {
+		return uuid.Nil, nil, err
+	}
+
+	return id, challenge, nil
+}
+
+func (cfg *apiConfig) handlerBeginPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Something went wrong")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	existing, err := cfg.db.ListUserWebAuthnCredentialIDs(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	challengeID, challenge, err := cfg.newWebAuthnChallenge(r.Context(), uuid.NullUUID{UUID: user.ID, Valid: true}, webAuthnRegisterPurpose)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	var options WebAuthnRegistrationOptions
+	options.ChallengeID = challengeID
+	options.PublicKey.Challenge = challenge
+	options.PublicKey.RP.ID = cfg.webauthn.ID
+	options.PublicKey.RP.Name = cfg.webauthn.Name
+	options.PublicKey.User.ID = user.ID[:]
+	options.PublicKey.User.Name = user.Email
+	options.PublicKey.User.DisplayName = user.DisplayName
+	if options.PublicKey.User.DisplayName == "" {
+		options.PublicKey.User.DisplayName = user.Email
+	}
+	options.PublicKey.PubKeyCredParams = []webAuthnCredentialParameter{{Type: "public-key", Alg: -7}}
+	options.PublicKey.AuthenticatorSelection.ResidentKey = "required"
+	options.PublicKey.AuthenticatorSelection.UserVerification = "required"
+	options.PublicKey.ExcludeCredentials = make([]webAuthnCredentialDescriptor, 0, len(existing))
+	for _, id := range existing {
+		options.PublicKey.ExcludeCredentials = append(options.PublicKey.ExcludeCredentials, webAuthnCredentialDescriptor{Type: "public-key", ID: id})
+	}
+	options.PublicKey.Attestation = "none"
+	options.PublicKey.Timeout = webAuthnChallengeTTL.Milliseconds()
+
+	respondWithJSON(w, http.StatusOK, options)
+}
+
+func (cfg *apiConfig) handlerFinishPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		ChallengeID uuid.UUID `json:"challenge_id"`
+		Name        string    `json:"name"`
+		Credential  struct {
+			Response struct {
+				ClientDataJSON    base64URL `json:"clientDataJSON"`
+				AttestationObject base64URL `json:"attestationObject"`
+			} `json:"response"`
+		} `json:"credential"`
+	}
+
+	userID, ok := userIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	var params parameters
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Something went wrong")
+		return
+	}
+
+	if len(params.Name) > maxPasskeyNameLength {
+		respondWithError(w, http.StatusBadRequest, "Passkey name is too long")
+		return
+	}
+
+	challenge, err := cfg.db.UseWebAuthnChallenge(r.Context(), database.UseWebAuthnChallengeParams{
+		ID:      params.ChallengeID,
+		Purpose: webAuthnRegisterPurpose,
+		UserID:  uuid.NullUUID{UUID: userID, Valid: true},
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusBadRequest, "Invalid or expired challenge")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	credential, err := cfg.webauthn.VerifyRegistration(challenge, params.Credential.Response.ClientDataJSON, params.Credential.Response.AttestationObject)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid passkey")
+		return
+	}
+
+	created, err := cfg.db.CreateWebAuthnCredential(r.Context(), database.CreateWebAuthnCredentialParams{
+		UserID:       userID,
+		CredentialID: credential.ID,
+		PublicKey:    credential.PublicKey,
+		SignCount:    int64(credential.SignCount),
+		Name:         params.Name,
+	})
+	if err != nil {
+		if isUniqueViolation(err, "webauthn_credentials_credential_id_key") {
+			respondWithError(w, http.StatusConflict, "Passkey is already registered")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, databasePasskeyToPasskey(created))
+}
+
+// handlerBeginPasskeyLogin starts a passwordless login. No account is named
+// up front: the browser offers whichever passkeys it holds for this site.
+func (cfg *apiConfig) handlerBeginPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	challengeID, challenge, err := cfg.newWebAuthnChallenge(r.Context(), uuid.NullUUID{}, webAuthnLoginPurpose)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	var options WebAuthnLoginOptions
+	options.ChallengeID = challengeID
+	options.PublicKey.Challenge = challenge
+	options.PublicKey.RPID = cfg.webauthn.ID
+	options.PublicKey.UserVerification = "required"
+	options.PublicKey.Timeout = webAuthnChallengeTTL.Milliseconds()
+
+	respondWithJSON(w, http.StatusOK, options)
+}
+
+// handlerFinishPasskeyLogin signs the user in with a passkey assertion and
+// responds exactly like handlerLogin. A passkey already proves possession
+// and, through user verification, a PIN or biometric, so TOTP isn't asked
+// for on top.
+func (cfg *apiConfig) handlerFinishPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		ChallengeID uuid.UUID `json:"challenge_id"`
+		Credential  struct {
+			RawID    base64URL `json:"rawId"`
+			Response struct {
+				ClientDataJSON    base64URL `json:"clientDataJSON"`
+				AuthenticatorData base64URL `json:"authenticatorData"`
+				Signature         base64URL `json:"signature"`
+				UserHandle        base64URL `json:"userHandle"`
+			} `json:"response"`
+		} `json:"credential"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	var params parameters
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Something went wrong")
+		return
+	}
+
+	challenge, err := cfg.db.UseWebAuthnChallenge(r.Context(), database.UseWebAuthnChallengeParams{
+		ID:      params.ChallengeID,
+		Purpose: webAuthnLoginPurpose,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	credential, err := cfg.db.GetWebAuthnCredential(r.Context(), params.Credential.RawID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	userHandle := params.Credential.Response.UserHandle
+	if len(userHandle) > 0 && string(userHandle) != string(credential.UserID[:]) {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	signCount, err := cfg.webauthn.VerifyAssertion(
+		challenge,
+		credential.PublicKey,
+		uint32(credential.SignCount),
+		params.Credential.Response.ClientDataJSON,
+		params.Credential.Response.AuthenticatorData,
+		params.Credential.Response.Signature,
+	)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Only move the counter on from the value we verified against, so two
+	// logins racing with the same assertion can't both succeed.
+	used, err := cfg.db.UseWebAuthnCredential(r.Context(), database.UseWebAuthnCredentialParams{
+		NewSignCount: int64(signCount),
+		ID:           credential.ID,
+		OldSignCount: credential.SignCount,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if used == 0 {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(r.Context(), credential.UserID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	cfg.respondWithLogin(w, r, user)
+}
+
+func (cfg *apiConfig) handlerListPasskeys(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	credentials, err := cfg.db.ListUserWebAuthnCredentials(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	response := make([]Passkey, 0, len(credentials))
+	for _, credential := range credentials {
+		response = append(response, databasePasskeyToPasskey(credential))
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (cfg *apiConfig) handlerDeletePasskey(w http.ResponseWriter, r *http.Request) {
+	passkeyIDStr := r.PathValue("passkeyID")
+	passkeyID, err := uuid.Parse(passkeyIDStr)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid passkey ID")
+		return
+	}
+
+	userID, ok := userIDFromContext(r.Context())
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	deleted, err := cfg.db.DeleteWebAuthnCredential(r.Context(), database.DeleteWebAuthnCredentialParams{
+		ID:     passkeyID,
+		UserID: userID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, http.StatusNotFound, "Passkey not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBase64URLJSON(t *testing.T) {
+	data, err := json.Marshal(base64URL{0xfb, 0xff, 0x01})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if string(data) != `"-_8B"` {
+		t.Fatalf("Marshal = %s, want %q", data, `"-_8B"`)
+	}
+
+	var decoded base64URL
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if string(decoded) != "\xfb\xff\x01" {
+		t.Fatalf("Unmarshal = %x", decoded)
+	}
+
+	// Browsers never pad or use the standard alphabet here.
+	if err := json.Unmarshal([]byte(`"+/8B"`), &decoded); err == nil {
+		t.Fatal("expected error for standard base64")
+	}
+}
+
+func TestHandlerPasskeyRegistrationRequiresAuth(t *testing.T) {
+	cfg := &apiConfig{tokenKeys: newTestKeyring(t)}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{name: "begin", handler: cfg.handlerBeginPasskeyRegistration},
+		{name: "finish", handler: cfg.handlerFinishPasskeyRegistration},
+		{name: "list", handler: cfg.handlerListPasskeys},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/passkeys", strings.NewReader(`{}`))
+			rec := httptest.NewRecorder()
+
+			tt.handler(rec, req)
+
+			if rec.Code != http.StatusUnauthorized {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+func TestHandlerFinishPasskeyLoginRejectsMalformedCredential(t *testing.T) {
+	cfg := &apiConfig{tokenKeys: newTestKeyring(t)}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/login/passkey/finish", strings.NewReader(`{"credential": {"rawId": "not base64!"}}`))
+	rec := httptest.NewRecorder()
+
+	cfg.handlerFinishPasskeyLogin(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
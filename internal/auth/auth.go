@@ -2,6 +2,7 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"net/http"
@@ -21,53 +22,95 @@ func CheckPasswordHash(password, hash string) (bool, error) {
 	return argon2id.ComparePasswordAndHash(password, hash)
 }
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
+// AccessTokenAudience is the audience of access tokens. Services verifying
+// Chirpy tokens against the JWKS should require it.
+const AccessTokenAudience = "chirpy-api"
+
+// AccessToken is what a valid access token says about its bearer.
+type AccessToken struct {
+	UserID uuid.UUID
+	Role   string
+	Scopes []string
+}
+
+// MakeJWT signs an access token for userID, who has role, that grants
+// scopes.
+func MakeJWT(userID uuid.UUID, role string, scopes []string, keys *Keyring, expiresIn time.Duration) (string, error) {
 	now := time.Now().UTC()
 
-	claims := jwt.RegisteredClaims{
-		Issuer:    "chirpy",
-		Subject:   userID.String(),
-		IssuedAt:  jwt.NewNumericDate(now),
-		ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
-	}
+	return keys.sign(tokenClaims{
+		Scope: strings.Join(scopes, " "),
+		Role:  role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   userID.String(),
+			Audience:  jwt.ClaimStrings{AccessTokenAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+		},
+	})
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+// ValidateJWT checks an access token and returns what it says about its
+// bearer. Tokens minted for a single purpose, such as email verification,
+// carry a different audience and are rejected.
+func ValidateJWT(tokenString string, keys *Keyring) (AccessToken, error) {
+	claims, err := keys.parse(tokenString, AccessTokenAudience)
+	if err != nil {
+		return AccessToken{}, err
+	}
 
-	signedToken, err := token.SignedString([]byte(tokenSecret))
+	userID, err := uuid.Parse(claims.Subject)
 	if err != nil {
-		return "", err
+		return AccessToken{}, err
 	}
 
-	return signedToken, nil
+	return AccessToken{
+		UserID: userID,
+		Role:   claims.Role,
+		Scopes: strings.Fields(claims.Scope),
+	}, nil
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	token, err := jwt.ParseWithClaims(
-		tokenString,
-		&jwt.RegisteredClaims{},
-		func(t *jwt.Token) (interface{}, error) {
-			return []byte(tokenSecret), nil
-		},
-	)
-	if err != nil {
-		return uuid.Nil, err
+// MakePurposeJWT signs a token that is only good for purpose, which is
+// stored as the audience. tokenID becomes the token's jti so callers can
+// make it single-use.
+func MakePurposeJWT(userID, tokenID uuid.UUID, purpose string, keys *Keyring, expiresIn time.Duration) (string, error) {
+	if purpose == AccessTokenAudience {
+		return "", errors.New("purpose would make an access token")
 	}
 
-	if !token.Valid {
-		return uuid.Nil, errors.New("invalid token")
-	}
+	now := time.Now().UTC()
 
-	claims, ok := token.Claims.(*jwt.RegisteredClaims)
-	if !ok {
-		return uuid.Nil, errors.New("invalid claims type")
+	return keys.sign(tokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   userID.String(),
+			Audience:  jwt.ClaimStrings{purpose},
+			ID:        tokenID.String(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+		},
+	})
+}
+
+// ValidatePurposeJWT checks a token made by MakePurposeJWT for the same
+// purpose and returns its user and token IDs.
+func ValidatePurposeJWT(tokenString, purpose string, keys *Keyring) (uuid.UUID, uuid.UUID, error) {
+	claims, err := keys.parse(tokenString, purpose)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
 	}
 
 	userID, err := uuid.Parse(claims.Subject)
 	if err != nil {
-		return uuid.Nil, err
+		return uuid.Nil, uuid.Nil, err
+	}
+
+	tokenID, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
 	}
 
-	return userID, nil
+	return userID, tokenID, nil
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -106,3 +149,23 @@ func MakeRefreshToken() (string, error) {
 
 	return hex.EncodeToString(tokenBytes), nil
 }
+
+// RefreshTokenIDLength is how many leading characters of a refresh token
+// are stored in the clear to look it up by.
+const RefreshTokenIDLength = 16
+
+// RefreshTokenID returns the lookup ID of a refresh token made by
+// MakeRefreshToken.
+func RefreshTokenID(token string) (string, error) {
+	if len(token) <= RefreshTokenIDLength {
+		return "", errors.New("malformed refresh token")
+	}
+	return token[:RefreshTokenIDLength], nil
+}
+
+// HashToken returns the hex SHA-256 digest of a random token. Tokens are
+// long enough that a fast, unsalted hash is safe to store and look up by.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 
@@ -36,49 +37,65 @@ func TestHashPasswordAndCheckPasswordHash(t *testing.T) {
 	}
 }
 
+func newTestKeyring(t *testing.T, secret string) *Keyring {
+	t.Helper()
+
+	keys, err := NewKeyring("http://localhost:8080", KeyFromSecret(secret))
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+	return keys
+}
+
 func TestJWTCreateAndValidate(t *testing.T) {
 	userID := uuid.New()
-	secret := "test-secret"
+	keys := newTestKeyring(t, "test-secret")
 
-	token, err := MakeJWT(userID, secret, time.Minute)
+	token, err := MakeJWT(userID, RoleModerator, SessionScopes, keys, time.Minute)
 	if err != nil {
 		t.Fatalf("MakeJWT() error = %v", err)
 	}
 
-	gotID, err := ValidateJWT(token, secret)
+	got, err := ValidateJWT(token, keys)
 	if err != nil {
 		t.Fatalf("ValidateJWT() error = %v", err)
 	}
-	if gotID != userID {
-		t.Fatalf("ValidateJWT() got %v, want %v", gotID, userID)
+	if got.UserID != userID {
+		t.Fatalf("ValidateJWT() got %v, want %v", got.UserID, userID)
+	}
+	if got.Role != RoleModerator {
+		t.Fatalf("ValidateJWT() role = %q, want %q", got.Role, RoleModerator)
+	}
+	if strings.Join(got.Scopes, " ") != strings.Join(SessionScopes, " ") {
+		t.Fatalf("ValidateJWT() scopes = %v, want %v", got.Scopes, SessionScopes)
 	}
 }
 
 func TestJWTExpiredTokenRejected(t *testing.T) {
 	userID := uuid.New()
-	secret := "test-secret"
+	keys := newTestKeyring(t, "test-secret")
 
-	token, err := MakeJWT(userID, secret, -time.Minute)
+	token, err := MakeJWT(userID, RoleUser, SessionScopes, keys, -time.Minute)
 	if err != nil {
 		t.Fatalf("MakeJWT() error = %v", err)
 	}
 
-	if _, err := ValidateJWT(token, secret); err == nil {
+	if _, err := ValidateJWT(token, keys); err == nil {
 		t.Fatalf("ValidateJWT() expected error for expired token")
 	}
 }
 
-func TestJWTWrongSecretRejected(t *testing.T) {
+func TestJWTWrongKeyRejected(t *testing.T) {
 	userID := uuid.New()
-	secret := "test-secret"
+	keys := newTestKeyring(t, "test-secret")
 
-	token, err := MakeJWT(userID, secret, time.Minute)
+	token, err := MakeJWT(userID, RoleUser, SessionScopes, keys, time.Minute)
 	if err != nil {
 		t.Fatalf("MakeJWT() error = %v", err)
 	}
 
-	if _, err := ValidateJWT(token, "other-secret"); err == nil {
-		t.Fatalf("ValidateJWT() expected error for wrong secret")
+	if _, err := ValidateJWT(token, newTestKeyring(t, "other-secret")); err == nil {
+		t.Fatalf("ValidateJWT() expected error for wrong key")
 	}
 }
 
@@ -140,3 +157,79 @@ func TestMakeRefreshToken(t *testing.T) {
 		}
 	}
 }
+
+func TestPurposeJWTCreateAndValidate(t *testing.T) {
+	userID := uuid.New()
+	tokenID := uuid.New()
+	keys := newTestKeyring(t, "test-secret")
+
+	token, err := MakePurposeJWT(userID, tokenID, "verify-email", keys, time.Minute)
+	if err != nil {
+		t.Fatalf("MakePurposeJWT() error = %v", err)
+	}
+
+	gotUserID, gotTokenID, err := ValidatePurposeJWT(token, "verify-email", keys)
+	if err != nil {
+		t.Fatalf("ValidatePurposeJWT() error = %v", err)
+	}
+	if gotUserID != userID || gotTokenID != tokenID {
+		t.Fatalf("ValidatePurposeJWT() got (%v, %v), want (%v, %v)", gotUserID, gotTokenID, userID, tokenID)
+	}
+
+	if _, _, err := ValidatePurposeJWT(token, "reset-password", keys); err == nil {
+		t.Fatalf("ValidatePurposeJWT() expected error for another purpose")
+	}
+}
+
+func TestPurposeJWTRejectedAsAccessToken(t *testing.T) {
+	keys := newTestKeyring(t, "test-secret")
+
+	token, err := MakePurposeJWT(uuid.New(), uuid.New(), "verify-email", keys, time.Minute)
+	if err != nil {
+		t.Fatalf("MakePurposeJWT() error = %v", err)
+	}
+
+	if _, err := ValidateJWT(token, keys); err == nil {
+		t.Fatalf("ValidateJWT() expected error for purpose token")
+	}
+}
+
+func TestAccessTokenRejectedAsPurposeJWT(t *testing.T) {
+	keys := newTestKeyring(t, "test-secret")
+
+	token, err := MakeJWT(uuid.New(), RoleUser, SessionScopes, keys, time.Minute)
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+
+	if _, _, err := ValidatePurposeJWT(token, "verify-email", keys); err == nil {
+		t.Fatalf("ValidatePurposeJWT() expected error for access token")
+	}
+}
+
+func TestHashToken(t *testing.T) {
+	got := HashToken("abc")
+	want := "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	if got != want {
+		t.Fatalf("HashToken() got %q, want %q", got, want)
+	}
+}
+
+func TestRefreshTokenID(t *testing.T) {
+	token, err := MakeRefreshToken()
+	if err != nil {
+		t.Fatalf("MakeRefreshToken() error = %v", err)
+	}
+
+	id, err := RefreshTokenID(token)
+	if err != nil {
+		t.Fatalf("RefreshTokenID() error = %v", err)
+	}
+	if id != token[:RefreshTokenIDLength] {
+		t.Fatalf("RefreshTokenID() got %q, want prefix of %q", id, token)
+	}
+
+	if _, err := RefreshTokenID("short"); err == nil {
+		t.Fatalf("RefreshTokenID() expected error for short token")
+	}
+}
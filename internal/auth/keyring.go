@@ -0,0 +1,228 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Keyring holds the Ed25519 key tokens are signed with and every key they
+// are still accepted from. To rotate, start signing with a new key and keep
+// the old public key as a verification key until the last token it signed
+// has expired.
+type Keyring struct {
+	issuer     string
+	signingKey ed25519.PrivateKey
+	signingKID string
+	keys       []keyringEntry
+}
+
+type keyringEntry struct {
+	kid string
+	key ed25519.PublicKey
+}
+
+// tokenClaims are the claims of every token a Keyring signs. Scope is a
+// space-separated list, as in RFC 9068; it and Role are only set on access
+// tokens.
+type tokenClaims struct {
+	Scope string `json:"scope,omitempty"`
+	Role  string `json:"role,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// JWK is an Ed25519 public key in JSON Web Key form (RFC 8037).
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+}
+
+// JWKS is a JSON Web Key Set, as served from /.well-known/jwks.json.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewKeyring returns a keyring for tokens issued by issuer. It signs with
+// signingKey and accepts tokens signed by it or any of verificationKeys.
+func NewKeyring(issuer string, signingKey ed25519.PrivateKey, verificationKeys ...ed25519.PublicKey) (*Keyring, error) {
+	if issuer == "" {
+		return nil, errors.New("keyring: issuer is required")
+	}
+	if len(signingKey) != ed25519.PrivateKeySize {
+		return nil, errors.New("keyring: invalid signing key")
+	}
+
+	publicKey := signingKey.Public().(ed25519.PublicKey)
+	k := &Keyring{
+		issuer:     issuer,
+		signingKey: signingKey,
+		signingKID: keyID(publicKey),
+	}
+	k.keys = append(k.keys, keyringEntry{kid: k.signingKID, key: publicKey})
+
+	for _, key := range verificationKeys {
+		if len(key) != ed25519.PublicKeySize {
+			return nil, errors.New("keyring: invalid verification key")
+		}
+		kid := keyID(key)
+		if k.verificationKey(kid) != nil {
+			continue
+		}
+		k.keys = append(k.keys, keyringEntry{kid: kid, key: key})
+	}
+
+	return k, nil
+}
+
+// KeyFromSecret derives a signing key from a shared secret. It's for
+// development setups that only configure BEARER_TOKEN; anyone who knows the
+// secret can mint tokens, so production should use a real key file.
+func KeyFromSecret(secret string) ed25519.PrivateKey {
+	seed := sha256.Sum256([]byte("chirpy-jwt-signing-key:" + secret))
+	return ed25519.NewKeyFromSeed(seed[:])
+}
+
+// ParseSigningKeyPEM reads a PKCS #8 Ed25519 private key, as written by
+// `openssl genpkey -algorithm ed25519`.
+func ParseSigningKeyPEM(data []byte) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, errors.New("keyring: no PRIVATE KEY block found")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("keyring: signing key is not Ed25519")
+	}
+
+	return privateKey, nil
+}
+
+// ParseVerificationKeysPEM reads any number of PKIX Ed25519 public keys,
+// as written by `openssl pkey -pubout`.
+func ParseVerificationKeysPEM(data []byte) ([]ed25519.PublicKey, error) {
+	var keys []ed25519.PublicKey
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "PUBLIC KEY" {
+			return nil, fmt.Errorf("keyring: unexpected %s block", block.Type)
+		}
+
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		publicKey, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return nil, errors.New("keyring: verification key is not Ed25519")
+		}
+		keys = append(keys, publicKey)
+	}
+
+	return keys, nil
+}
+
+// JWKS returns the public half of every key in the keyring, signing key
+// first.
+func (k *Keyring) JWKS() JWKS {
+	jwks := JWKS{Keys: make([]JWK, 0, len(k.keys))}
+	for _, entry := range k.keys {
+		jwks.Keys = append(jwks.Keys, JWK{
+			KeyType:   "OKP",
+			Curve:     "Ed25519",
+			X:         base64.RawURLEncoding.EncodeToString(entry.key),
+			KeyID:     entry.kid,
+			Use:       "sig",
+			Algorithm: jwt.SigningMethodEdDSA.Alg(),
+		})
+	}
+	return jwks
+}
+
+func (k *Keyring) sign(claims tokenClaims) (string, error) {
+	claims.Issuer = k.issuer
+
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = k.signingKID
+
+	return token.SignedString(k.signingKey)
+}
+
+// parse verifies a token signed by this keyring for audience. The
+// algorithm is pinned so a token can't pick how it is checked, and the key
+// is chosen by kid from this keyring only.
+func (k *Keyring) parse(tokenString, audience string) (*tokenClaims, error) {
+	claims := &tokenClaims{}
+	_, err := jwt.ParseWithClaims(
+		tokenString,
+		claims,
+		func(t *jwt.Token) (interface{}, error) {
+			kid, _ := t.Header["kid"].(string)
+			key := k.verificationKey(kid)
+			if key == nil {
+				return nil, errors.New("unknown signing key")
+			}
+			return key, nil
+		},
+		jwt.WithValidMethods([]string{jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithIssuer(k.issuer),
+		jwt.WithAudience(audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// WithAudience only checks that audience is one of several; our
+	// tokens are each good for exactly one.
+	if len(claims.Audience) != 1 {
+		return nil, errors.New("unexpected audience")
+	}
+
+	return claims, nil
+}
+
+func (k *Keyring) verificationKey(kid string) ed25519.PublicKey {
+	for _, entry := range k.keys {
+		if entry.kid == kid {
+			return entry.key
+		}
+	}
+	return nil
+}
+
+// keyID is the RFC 7638 thumbprint of an Ed25519 public key, so the same
+// key always gets the same kid without having to configure one.
+func keyID(key ed25519.PublicKey) string {
+	thumbprint, _ := json.Marshal(struct {
+		Curve   string `json:"crv"`
+		KeyType string `json:"kty"`
+		X       string `json:"x"`
+	}{
+		Curve:   "Ed25519",
+		KeyType: "OKP",
+		X:       base64.RawURLEncoding.EncodeToString(key),
+	})
+	sum := sha256.Sum256(thumbprint)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
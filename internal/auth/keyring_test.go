@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Example from RFC 8037 appendix A.3.
+func TestKeyIDRFC8037Thumbprint(t *testing.T) {
+	x, err := base64.RawURLEncoding.DecodeString("11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo")
+	if err != nil {
+		t.Fatalf("DecodeString: %v", err)
+	}
+
+	if got, want := keyID(ed25519.PublicKey(x)), "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k"; got != want {
+		t.Fatalf("keyID() = %q, want %q", got, want)
+	}
+}
+
+func TestKeyringRotation(t *testing.T) {
+	oldKey := KeyFromSecret("old")
+	newKey := KeyFromSecret("new")
+
+	oldKeys, err := NewKeyring("chirpy", oldKey)
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+	token, err := MakeJWT(uuid.New(), RoleUser, SessionScopes, oldKeys, time.Minute)
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+
+	rotated, err := NewKeyring("chirpy", newKey, oldKey.Public().(ed25519.PublicKey))
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+	if _, err := ValidateJWT(token, rotated); err != nil {
+		t.Fatalf("ValidateJWT() with old key still trusted error = %v", err)
+	}
+
+	retired, err := NewKeyring("chirpy", newKey)
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+	if _, err := ValidateJWT(token, retired); err == nil {
+		t.Fatal("ValidateJWT() expected error once old key is retired")
+	}
+
+	jwks := rotated.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("len(JWKS().Keys) = %d, want 2", len(jwks.Keys))
+	}
+	if jwks.Keys[0].KeyID != rotated.signingKID {
+		t.Fatalf("JWKS().Keys[0] = %q, want signing key %q", jwks.Keys[0].KeyID, rotated.signingKID)
+	}
+	for _, key := range jwks.Keys {
+		if key.KeyType != "OKP" || key.Curve != "Ed25519" || key.Algorithm != "EdDSA" || key.Use != "sig" {
+			t.Fatalf("unexpected JWK %+v", key)
+		}
+	}
+}
+
+func TestKeyringRejectsForgedTokens(t *testing.T) {
+	keys := newTestKeyring(t, "test-secret")
+	userID := uuid.New()
+	now := time.Now()
+	accessClaims := func() jwt.RegisteredClaims {
+		return jwt.RegisteredClaims{
+			Issuer:    keys.issuer,
+			Subject:   userID.String(),
+			Audience:  jwt.ClaimStrings{AccessTokenAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		}
+	}
+
+	tests := []struct {
+		name  string
+		token func() (string, error)
+	}{
+		{
+			name: "HS256 keyed with the public key",
+			token: func() (string, error) {
+				token := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims())
+				token.Header["kid"] = keys.signingKID
+				return token.SignedString([]byte(keys.keys[0].key))
+			},
+		},
+		{
+			name: "unsigned",
+			token: func() (string, error) {
+				token := jwt.NewWithClaims(jwt.SigningMethodNone, accessClaims())
+				token.Header["kid"] = keys.signingKID
+				return token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+			},
+		},
+		{
+			name: "unknown kid",
+			token: func() (string, error) {
+				token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, accessClaims())
+				token.Header["kid"] = "nope"
+				return token.SignedString(keys.signingKey)
+			},
+		},
+		{
+			name: "wrong issuer",
+			token: func() (string, error) {
+				claims := accessClaims()
+				claims.Issuer = "someone-else"
+				token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+				token.Header["kid"] = keys.signingKID
+				return token.SignedString(keys.signingKey)
+			},
+		},
+		{
+			name: "extra audience",
+			token: func() (string, error) {
+				claims := accessClaims()
+				claims.Audience = append(claims.Audience, "chirpy-mfa-challenge")
+				token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+				token.Header["kid"] = keys.signingKID
+				return token.SignedString(keys.signingKey)
+			},
+		},
+		{
+			name: "no expiry",
+			token: func() (string, error) {
+				claims := accessClaims()
+				claims.ExpiresAt = nil
+				token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+				token.Header["kid"] = keys.signingKID
+				return token.SignedString(keys.signingKey)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := tt.token()
+			if err != nil {
+				t.Fatalf("signing: %v", err)
+			}
+			if _, err := ValidateJWT(token, keys); err == nil {
+				t.Fatal("ValidateJWT() expected error")
+			}
+		})
+	}
+}
+
+func TestParseKeysPEM(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	otherPublicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey: %v", err)
+	}
+	gotPrivate, err := ParseSigningKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		t.Fatalf("ParseSigningKeyPEM() error = %v", err)
+	}
+	if !gotPrivate.Equal(privateKey) {
+		t.Fatal("ParseSigningKeyPEM() returned a different key")
+	}
+
+	var publicPEM []byte
+	for _, key := range []ed25519.PublicKey{publicKey, otherPublicKey} {
+		der, err := x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			t.Fatalf("MarshalPKIXPublicKey: %v", err)
+		}
+		publicPEM = append(publicPEM, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})...)
+	}
+	gotPublic, err := ParseVerificationKeysPEM(publicPEM)
+	if err != nil {
+		t.Fatalf("ParseVerificationKeysPEM() error = %v", err)
+	}
+	if len(gotPublic) != 2 || !gotPublic[0].Equal(publicKey) || !gotPublic[1].Equal(otherPublicKey) {
+		t.Fatalf("ParseVerificationKeysPEM() = %v", gotPublic)
+	}
+
+	if _, err := ParseVerificationKeysPEM(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})); err == nil {
+		t.Fatal("ParseVerificationKeysPEM() expected error for a private key")
+	}
+}
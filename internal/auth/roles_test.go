@@ -0,0 +1,25 @@
+package auth
+
+import "testing"
+
+func TestHasRole(t *testing.T) {
+	tests := []struct {
+		role string
+		min  string
+		want bool
+	}{
+		{role: RoleAdmin, min: RoleAdmin, want: true},
+		{role: RoleAdmin, min: RoleModerator, want: true},
+		{role: RoleModerator, min: RoleUser, want: true},
+		{role: RoleModerator, min: RoleAdmin, want: false},
+		{role: RoleUser, min: RoleModerator, want: false},
+		{role: "", min: RoleUser, want: false},
+		{role: "root", min: RoleUser, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := HasRole(tt.role, tt.min); got != tt.want {
+			t.Fatalf("HasRole(%q, %q) = %v, want %v", tt.role, tt.min, got, tt.want)
+		}
+	}
+}
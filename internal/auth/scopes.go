@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Scopes limit what an access token can be used for. Tokens from logging
+// in carry SessionScopes; personal access tokens carry whichever of
+// GrantableScopes their owner picked.
+const (
+	ScopeChirpsRead  = "chirps:read"
+	ScopeChirpsWrite = "chirps:write"
+	ScopeUsersWrite  = "users:write"
+	// ScopeAccount covers credentials and security settings: passwords,
+	// two-factor, passkeys, sessions and personal access tokens. It is
+	// never granted to a personal access token, so a leaked one can't be
+	// used to take the account over.
+	ScopeAccount = "account"
+)
+
+var GrantableScopes = []string{ScopeChirpsRead, ScopeChirpsWrite, ScopeUsersWrite}
+
+var SessionScopes = append(append([]string{}, GrantableScopes...), ScopeAccount)
+
+// PersonalAccessTokenPrefix starts every personal access token, which
+// tells them apart from JWTs and makes them easy to spot in leaked logs
+// and commits.
+const PersonalAccessTokenPrefix = "chirpy_pat_"
+
+func HasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateGrantableScopes checks scopes requested for a personal access
+// token and returns them without duplicates.
+func ValidateGrantableScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, errors.New("at least one scope is required")
+	}
+
+	valid := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		if !HasScope(GrantableScopes, scope) {
+			return nil, fmt.Errorf("unknown scope %q", scope)
+		}
+		if !HasScope(valid, scope) {
+			valid = append(valid, scope)
+		}
+	}
+
+	return valid, nil
+}
+
+// MakePersonalAccessToken returns a new random personal access token.
+func MakePersonalAccessToken() (string, error) {
+	token, err := MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	return PersonalAccessTokenPrefix + token, nil
+}
+
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalAccessTokenPrefix)
+}
@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestValidateGrantableScopes(t *testing.T) {
+	got, err := ValidateGrantableScopes([]string{ScopeChirpsWrite, ScopeChirpsRead, ScopeChirpsWrite})
+	if err != nil {
+		t.Fatalf("ValidateGrantableScopes() error = %v", err)
+	}
+	if want := []string{ScopeChirpsWrite, ScopeChirpsRead}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("ValidateGrantableScopes() = %v, want %v", got, want)
+	}
+
+	for _, scopes := range [][]string{nil, {ScopeAccount}, {ScopeChirpsRead, "admin"}} {
+		if _, err := ValidateGrantableScopes(scopes); err == nil {
+			t.Fatalf("ValidateGrantableScopes(%v) expected error", scopes)
+		}
+	}
+}
+
+func TestMakePersonalAccessToken(t *testing.T) {
+	token, err := MakePersonalAccessToken()
+	if err != nil {
+		t.Fatalf("MakePersonalAccessToken() error = %v", err)
+	}
+	if !IsPersonalAccessToken(token) {
+		t.Fatalf("IsPersonalAccessToken(%q) = false", token)
+	}
+	if len(token) != len(PersonalAccessTokenPrefix)+64 {
+		t.Fatalf("len(token) = %d", len(token))
+	}
+
+	jwt, err := MakeJWT(uuid.New(), RoleUser, SessionScopes, newTestKeyring(t, "secret"), time.Minute)
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+	if IsPersonalAccessToken(jwt) {
+		t.Fatal("IsPersonalAccessToken() = true for a JWT")
+	}
+}
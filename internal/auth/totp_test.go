@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test vectors from RFC 6238 appendix B for HMAC-SHA1.
+func TestHOTPRFC6238Vectors(t *testing.T) {
+	key := []byte("12345678901234567890")
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "94287082"},
+		{unix: 1111111109, want: "07081804"},
+		{unix: 1111111111, want: "14050471"},
+		{unix: 1234567890, want: "89005924"},
+		{unix: 2000000000, want: "69279037"},
+		{unix: 20000000000, want: "65353130"},
+	}
+
+	for _, tt := range tests {
+		step := TOTPStep(time.Unix(tt.unix, 0))
+		if got := hotp(key, uint64(step), 8); got != tt.want {
+			t.Fatalf("hotp(t=%d) got %q, want %q", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestTOTPCodeAndValidate(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1111111111, 0)
+
+	code, err := TOTPCode(secret, now)
+	if err != nil {
+		t.Fatalf("TOTPCode() error = %v", err)
+	}
+	if code != "050471" {
+		t.Fatalf("TOTPCode() got %q, want %q", code, "050471")
+	}
+
+	step, ok := ValidateTOTP(secret, code, now)
+	if !ok || step != TOTPStep(now) {
+		t.Fatalf("ValidateTOTP() got (%d, %v), want (%d, true)", step, ok, TOTPStep(now))
+	}
+
+	if _, ok := ValidateTOTP(secret, code, now.Add(TOTPPeriod)); !ok {
+		t.Fatalf("ValidateTOTP() rejected a code one period old")
+	}
+	if _, ok := ValidateTOTP(secret, code, now.Add(3*TOTPPeriod)); ok {
+		t.Fatalf("ValidateTOTP() accepted a code three periods old")
+	}
+	if _, ok := ValidateTOTP(secret, "000000", now); ok {
+		t.Fatalf("ValidateTOTP() accepted a wrong code")
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret() error = %v", err)
+	}
+	if len(secret) != 32 {
+		t.Fatalf("GenerateTOTPSecret() got length %d, want 32", len(secret))
+	}
+	if _, err := TOTPCode(secret, time.Now()); err != nil {
+		t.Fatalf("TOTPCode() rejected generated secret: %v", err)
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	got := TOTPURI("JBSWY3DPEHPK3PXP", "Chirpy", "user@example.com")
+	want := "otpauth://totp/Chirpy:user@example.com?algorithm=SHA1&digits=6&issuer=Chirpy&period=30&secret=JBSWY3DPEHPK3PXP"
+	if got != want {
+		t.Fatalf("TOTPURI() got %q, want %q", got, want)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes() error = %v", err)
+	}
+	if len(codes) != 10 {
+		t.Fatalf("GenerateRecoveryCodes() got %d codes, want 10", len(codes))
+	}
+
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Fatalf("recovery code %q has the wrong shape", code)
+		}
+		if seen[code] {
+			t.Fatalf("duplicate recovery code %q", code)
+		}
+		seen[code] = true
+
+		typed := " " + strings.ToUpper(code) + " "
+		if NormalizeRecoveryCode(typed) != NormalizeRecoveryCode(code) {
+			t.Fatalf("NormalizeRecoveryCode(%q) != NormalizeRecoveryCode(%q)", typed, code)
+		}
+	}
+}
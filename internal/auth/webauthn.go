@@ -0,0 +1,265 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math/big"
+)
+
+// WebAuthn (https://www.w3.org/TR/webauthn-2/) support for passkeys. Only
+// ES256 credentials and "none" attestation are accepted, which is what
+// browsers hand out when the relying party doesn't ask for attestation.
+
+const (
+	webAuthnFlagUserPresent  = 0x01
+	webAuthnFlagUserVerified = 0x04
+	webAuthnFlagAttested     = 0x40
+
+	coseKeyTypeEC2 = 2
+	coseAlgES256   = -7
+	coseCurveP256  = 1
+)
+
+var (
+	ErrWebAuthnChallenge = errors.New("webauthn: challenge mismatch")
+	ErrWebAuthnOrigin    = errors.New("webauthn: origin mismatch")
+	ErrWebAuthnSignCount = errors.New("webauthn: sign count did not increase")
+)
+
+// WebAuthnRelyingParty is this server as WebAuthn sees it. ID is the
+// domain credentials are scoped to and Origin the exact origin the browser
+// reports, e.g. "example.com" and "https://example.com".
+type WebAuthnRelyingParty struct {
+	ID     string
+	Name   string
+	Origin string
+}
+
+// WebAuthnCredential is a newly registered passkey. PublicKey is PKIX DER.
+type WebAuthnCredential struct {
+	ID        []byte
+	PublicKey []byte
+	SignCount uint32
+}
+
+type webAuthnClientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+type webAuthnAuthData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    *ecdsa.PublicKey
+}
+
+// NewWebAuthnChallenge returns 32 random bytes for a ceremony.
+func NewWebAuthnChallenge() ([]byte, error) {
+	challenge := make([]byte, 32)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// VerifyRegistration checks the response to navigator.credentials.create()
+// and returns the credential to store.
+func (rp WebAuthnRelyingParty) VerifyRegistration(challenge, clientDataJSON, attestationObject []byte) (WebAuthnCredential, error) {
+	if err := rp.verifyClientData(clientDataJSON, "webauthn.create", challenge); err != nil {
+		return WebAuthnCredential{}, err
+	}
+
+	decoded, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return WebAuthnCredential{}, err
+	}
+	attestation, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return WebAuthnCredential{}, errors.New("webauthn: malformed attestation object")
+	}
+	if format, _ := attestation["fmt"].(string); format != "none" {
+		return WebAuthnCredential{}, errors.New("webauthn: unsupported attestation format")
+	}
+	rawAuthData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return WebAuthnCredential{}, errors.New("webauthn: missing authenticator data")
+	}
+
+	authData, err := parseWebAuthnAuthData(rawAuthData)
+	if err != nil {
+		return WebAuthnCredential{}, err
+	}
+	if err := rp.verifyAuthData(authData); err != nil {
+		return WebAuthnCredential{}, err
+	}
+	if authData.publicKey == nil {
+		return WebAuthnCredential{}, errors.New("webauthn: no attested credential")
+	}
+
+	publicKey, err := x509.MarshalPKIXPublicKey(authData.publicKey)
+	if err != nil {
+		return WebAuthnCredential{}, err
+	}
+
+	return WebAuthnCredential{
+		ID:        authData.credentialID,
+		PublicKey: publicKey,
+		SignCount: authData.signCount,
+	}, nil
+}
+
+// VerifyAssertion checks the response to navigator.credentials.get()
+// against a stored credential and returns the authenticator's new sign
+// count. A count that doesn't go up, when the authenticator keeps one,
+// suggests the credential was cloned and is rejected.
+func (rp WebAuthnRelyingParty) VerifyAssertion(challenge, publicKey []byte, storedSignCount uint32, clientDataJSON, authenticatorData, signature []byte) (uint32, error) {
+	if err := rp.verifyClientData(clientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+
+	authData, err := parseWebAuthnAuthData(authenticatorData)
+	if err != nil {
+		return 0, err
+	}
+	if err := rp.verifyAuthData(authData); err != nil {
+		return 0, err
+	}
+
+	parsed, err := x509.ParsePKIXPublicKey(publicKey)
+	if err != nil {
+		return 0, err
+	}
+	key, ok := parsed.(*ecdsa.PublicKey)
+	if !ok {
+		return 0, errors.New("webauthn: unsupported public key")
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := sha256.Sum256(append(append([]byte{}, authenticatorData...), clientDataHash[:]...))
+	if !ecdsa.VerifyASN1(key, signed[:], signature) {
+		return 0, errors.New("webauthn: bad signature")
+	}
+
+	if (authData.signCount != 0 || storedSignCount != 0) && authData.signCount <= storedSignCount {
+		return 0, ErrWebAuthnSignCount
+	}
+
+	return authData.signCount, nil
+}
+
+func (rp WebAuthnRelyingParty) verifyClientData(clientDataJSON []byte, ceremony string, challenge []byte) error {
+	var clientData webAuthnClientData
+	if err := json.Unmarshal(clientDataJSON, &clientData); err != nil {
+		return err
+	}
+	if clientData.Type != ceremony {
+		return errors.New("webauthn: wrong ceremony type")
+	}
+
+	got, err := base64.RawURLEncoding.DecodeString(clientData.Challenge)
+	if err != nil || subtle.ConstantTimeCompare(got, challenge) != 1 {
+		return ErrWebAuthnChallenge
+	}
+	if clientData.Origin != rp.Origin {
+		return ErrWebAuthnOrigin
+	}
+	return nil
+}
+
+// verifyAuthData checks the parts of authenticator data shared by both
+// ceremonies. Passkeys replace the password, so the authenticator must
+// have verified the user (PIN, biometrics), not just seen a tap.
+func (rp WebAuthnRelyingParty) verifyAuthData(authData webAuthnAuthData) error {
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(authData.rpIDHash, rpIDHash[:]) {
+		return errors.New("webauthn: relying party ID mismatch")
+	}
+	if authData.flags&webAuthnFlagUserPresent == 0 {
+		return errors.New("webauthn: user not present")
+	}
+	if authData.flags&webAuthnFlagUserVerified == 0 {
+		return errors.New("webauthn: user not verified")
+	}
+	return nil
+}
+
+func parseWebAuthnAuthData(data []byte) (webAuthnAuthData, error) {
+	if len(data) < 37 {
+		return webAuthnAuthData{}, errors.New("webauthn: authenticator data too short")
+	}
+
+	authData := webAuthnAuthData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	if authData.flags&webAuthnFlagAttested == 0 {
+		return authData, nil
+	}
+
+	rest := data[37:]
+	if len(rest) < 18 {
+		return webAuthnAuthData{}, errors.New("webauthn: attested credential data too short")
+	}
+	idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if len(rest) < idLength {
+		return webAuthnAuthData{}, errors.New("webauthn: credential ID too short")
+	}
+	authData.credentialID = rest[:idLength]
+
+	coseKey, _, err := decodeCBOR(rest[idLength:])
+	if err != nil {
+		return webAuthnAuthData{}, err
+	}
+	authData.publicKey, err = parseCOSEKey(coseKey)
+	if err != nil {
+		return webAuthnAuthData{}, err
+	}
+
+	return authData, nil
+}
+
+// parseCOSEKey reads an ES256 public key in COSE_Key form (RFC 8152).
+func parseCOSEKey(value interface{}) (*ecdsa.PublicKey, error) {
+	key, ok := value.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("webauthn: malformed COSE key")
+	}
+
+	kty, _ := key[int64(1)].(int64)
+	alg, _ := key[int64(3)].(int64)
+	crv, _ := key[int64(-1)].(int64)
+	if kty != coseKeyTypeEC2 || alg != coseAlgES256 || crv != coseCurveP256 {
+		return nil, errors.New("webauthn: only ES256 keys are supported")
+	}
+
+	x, _ := key[int64(-2)].([]byte)
+	y, _ := key[int64(-3)].([]byte)
+	if len(x) != 32 || len(y) != 32 {
+		return nil, errors.New("webauthn: malformed EC2 coordinates")
+	}
+
+	publicKey := &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(x),
+		Y:     new(big.Int).SetBytes(y),
+	}
+	if !publicKey.Curve.IsOnCurve(publicKey.X, publicKey.Y) {
+		return nil, errors.New("webauthn: point not on curve")
+	}
+
+	return publicKey, nil
+}
@@ -0,0 +1,393 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"sort"
+	"testing"
+)
+
+var testRelyingParty = WebAuthnRelyingParty{
+	ID:     "localhost",
+	Name:   "Chirpy",
+	Origin: "http://localhost:8080",
+}
+
+// softAuthenticator plays the part of a platform authenticator so the
+// ceremonies can be exercised without a browser.
+type softAuthenticator struct {
+	t            *testing.T
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	signCount    uint32
+	flags        byte
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	credentialID := make([]byte, 16)
+	if _, err := rand.Read(credentialID); err != nil {
+		t.Fatalf("rand.Read: %v", err)
+	}
+
+	return &softAuthenticator{
+		t:            t,
+		key:          key,
+		credentialID: credentialID,
+		flags:        webAuthnFlagUserPresent | webAuthnFlagUserVerified,
+	}
+}
+
+func (a *softAuthenticator) clientData(ceremony string, challenge []byte, origin string) []byte {
+	a.t.Helper()
+
+	clientData, err := json.Marshal(webAuthnClientData{
+		Type:      ceremony,
+		Challenge: base64.RawURLEncoding.EncodeToString(challenge),
+		Origin:    origin,
+	})
+	if err != nil {
+		a.t.Fatalf("json.Marshal: %v", err)
+	}
+	return clientData
+}
+
+func (a *softAuthenticator) authData(rpID string, flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	authData := append([]byte{}, rpIDHash[:]...)
+	authData = append(authData, flags)
+	return binary.BigEndian.AppendUint32(authData, a.signCount)
+}
+
+func (a *softAuthenticator) create(challenge []byte) (clientDataJSON, attestationObject []byte) {
+	authData := a.authData(testRelyingParty.ID, a.flags|webAuthnFlagAttested)
+	authData = append(authData, make([]byte, 16)...) // AAGUID
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.credentialID)))
+	authData = append(authData, a.credentialID...)
+	authData = append(authData, encodeTestCBOR(map[interface{}]interface{}{
+		int64(1):  int64(coseKeyTypeEC2),
+		int64(3):  int64(coseAlgES256),
+		int64(-1): int64(coseCurveP256),
+		int64(-2): a.key.X.FillBytes(make([]byte, 32)),
+		int64(-3): a.key.Y.FillBytes(make([]byte, 32)),
+	})...)
+
+	attestationObject = encodeTestCBOR(map[interface{}]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[interface{}]interface{}{},
+		"authData": authData,
+	})
+	return a.clientData("webauthn.create", challenge, testRelyingParty.Origin), attestationObject
+}
+
+func (a *softAuthenticator) get(challenge []byte) (clientDataJSON, authenticatorData, signature []byte) {
+	a.t.Helper()
+
+	a.signCount++
+	clientDataJSON = a.clientData("webauthn.get", challenge, testRelyingParty.Origin)
+	authenticatorData = a.authData(testRelyingParty.ID, a.flags)
+	return clientDataJSON, authenticatorData, a.sign(clientDataJSON, authenticatorData)
+}
+
+func (a *softAuthenticator) sign(clientDataJSON, authenticatorData []byte) []byte {
+	a.t.Helper()
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte{}, authenticatorData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		a.t.Fatalf("SignASN1: %v", err)
+	}
+	return signature
+}
+
+// encodeTestCBOR is the inverse of decodeCBOR for the types it returns.
+// Map keys are written in sorted order so output is deterministic.
+func encodeTestCBOR(value interface{}) []byte {
+	head := func(major byte, n uint64) []byte {
+		switch {
+		case n < 24:
+			return []byte{major<<5 | byte(n)}
+		case n <= 0xff:
+			return []byte{major<<5 | 24, byte(n)}
+		case n <= 0xffff:
+			return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+		default:
+			return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+		}
+	}
+
+	switch v := value.(type) {
+	case int64:
+		if v < 0 {
+			return head(1, uint64(-1-v))
+		}
+		return head(0, uint64(v))
+	case []byte:
+		return append(head(2, uint64(len(v))), v...)
+	case string:
+		return append(head(3, uint64(len(v))), v...)
+	case bool:
+		if v {
+			return []byte{0xf5}
+		}
+		return []byte{0xf4}
+	case nil:
+		return []byte{0xf6}
+	case []interface{}:
+		out := head(4, uint64(len(v)))
+		for _, item := range v {
+			out = append(out, encodeTestCBOR(item)...)
+		}
+		return out
+	case map[interface{}]interface{}:
+		keys := make([][]byte, 0, len(v))
+		encoded := make(map[string][]byte, len(v))
+		for key, item := range v {
+			k := encodeTestCBOR(key)
+			keys = append(keys, k)
+			encoded[string(k)] = encodeTestCBOR(item)
+		}
+		sort.Slice(keys, func(i, j int) bool { return string(keys[i]) < string(keys[j]) })
+
+		out := head(5, uint64(len(v)))
+		for _, k := range keys {
+			out = append(out, k...)
+			out = append(out, encoded[string(k)]...)
+		}
+		return out
+	default:
+		panic("encodeTestCBOR: unsupported type")
+	}
+}
+
+func TestDecodeCBOR(t *testing.T) {
+	data := encodeTestCBOR(map[interface{}]interface{}{
+		int64(-3): []byte{1, 2, 3},
+		"list":    []interface{}{int64(0), int64(500), int64(-70000), true, nil},
+	})
+	data = append(data, 0xaa)
+
+	value, rest, err := decodeCBOR(data)
+	if err != nil {
+		t.Fatalf("decodeCBOR() error = %v", err)
+	}
+	if len(rest) != 1 || rest[0] != 0xaa {
+		t.Fatalf("rest = %x, want aa", rest)
+	}
+
+	m, ok := value.(map[interface{}]interface{})
+	if !ok {
+		t.Fatalf("value is %T, want map", value)
+	}
+	if got, _ := m[int64(-3)].([]byte); string(got) != "\x01\x02\x03" {
+		t.Fatalf("m[-3] = %v", m[int64(-3)])
+	}
+	list, _ := m["list"].([]interface{})
+	if len(list) != 5 || list[1] != int64(500) || list[2] != int64(-70000) || list[3] != true || list[4] != nil {
+		t.Fatalf("m[list] = %v", m["list"])
+	}
+}
+
+func TestDecodeCBORRejectsMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty", data: nil},
+		{name: "truncated string", data: []byte{0x45, 1, 2}},
+		{name: "indefinite length", data: []byte{0x5f, 0x41, 1, 0xff}},
+		{name: "tag", data: []byte{0xc0, 0x00}},
+		{name: "float", data: []byte{0xf9, 0x3c, 0x00}},
+		{name: "huge array", data: []byte{0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{name: "duplicate key", data: []byte{0xa2, 0x01, 0x00, 0x01, 0x00}},
+		{name: "array key", data: []byte{0xa1, 0x80, 0x00}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := decodeCBOR(tt.data); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+
+	deep := make([]byte, maxCBORDepth+2)
+	for i := range deep {
+		deep[i] = 0x81
+	}
+	if _, _, err := decodeCBOR(deep); err == nil {
+		t.Fatal("expected error for deep nesting")
+	}
+}
+
+func TestWebAuthnRegistrationAndAssertion(t *testing.T) {
+	authenticator := newSoftAuthenticator(t)
+
+	challenge, err := NewWebAuthnChallenge()
+	if err != nil {
+		t.Fatalf("NewWebAuthnChallenge() error = %v", err)
+	}
+	clientDataJSON, attestationObject := authenticator.create(challenge)
+
+	credential, err := testRelyingParty.VerifyRegistration(challenge, clientDataJSON, attestationObject)
+	if err != nil {
+		t.Fatalf("VerifyRegistration() error = %v", err)
+	}
+	if string(credential.ID) != string(authenticator.credentialID) {
+		t.Fatalf("credential ID = %x, want %x", credential.ID, authenticator.credentialID)
+	}
+
+	challenge, _ = NewWebAuthnChallenge()
+	clientDataJSON, authData, signature := authenticator.get(challenge)
+
+	signCount, err := testRelyingParty.VerifyAssertion(challenge, credential.PublicKey, credential.SignCount, clientDataJSON, authData, signature)
+	if err != nil {
+		t.Fatalf("VerifyAssertion() error = %v", err)
+	}
+	if signCount != 1 {
+		t.Fatalf("signCount = %d, want 1", signCount)
+	}
+
+	// Replaying the same counter value looks like a cloned authenticator.
+	if _, err := testRelyingParty.VerifyAssertion(challenge, credential.PublicKey, signCount, clientDataJSON, authData, signature); !errors.Is(err, ErrWebAuthnSignCount) {
+		t.Fatalf("VerifyAssertion() with stale sign count error = %v, want %v", err, ErrWebAuthnSignCount)
+	}
+}
+
+func TestWebAuthnAssertionWithoutSignCount(t *testing.T) {
+	authenticator := newSoftAuthenticator(t)
+	challenge, _ := NewWebAuthnChallenge()
+	clientDataJSON, attestationObject := authenticator.create(challenge)
+	credential, err := testRelyingParty.VerifyRegistration(challenge, clientDataJSON, attestationObject)
+	if err != nil {
+		t.Fatalf("VerifyRegistration() error = %v", err)
+	}
+
+	// Some authenticators never increment the counter and always send 0.
+	clientDataJSON = authenticator.clientData("webauthn.get", challenge, testRelyingParty.Origin)
+	authData := authenticator.authData(testRelyingParty.ID, authenticator.flags)
+	signature := authenticator.sign(clientDataJSON, authData)
+
+	if _, err := testRelyingParty.VerifyAssertion(challenge, credential.PublicKey, 0, clientDataJSON, authData, signature); err != nil {
+		t.Fatalf("VerifyAssertion() error = %v", err)
+	}
+}
+
+func TestWebAuthnAssertionRejectsTampering(t *testing.T) {
+	authenticator := newSoftAuthenticator(t)
+	challenge, _ := NewWebAuthnChallenge()
+	clientDataJSON, attestationObject := authenticator.create(challenge)
+	credential, err := testRelyingParty.VerifyRegistration(challenge, clientDataJSON, attestationObject)
+	if err != nil {
+		t.Fatalf("VerifyRegistration() error = %v", err)
+	}
+
+	otherChallenge, _ := NewWebAuthnChallenge()
+	other := newSoftAuthenticator(t)
+
+	tests := []struct {
+		name   string
+		assert func() ([]byte, []byte, []byte)
+	}{
+		{
+			name: "wrong challenge",
+			assert: func() ([]byte, []byte, []byte) {
+				return authenticator.get(otherChallenge)
+			},
+		},
+		{
+			name: "wrong origin",
+			assert: func() ([]byte, []byte, []byte) {
+				authenticator.signCount++
+				clientDataJSON := authenticator.clientData("webauthn.get", challenge, "https://evil.example")
+				authData := authenticator.authData(testRelyingParty.ID, authenticator.flags)
+				return clientDataJSON, authData, authenticator.sign(clientDataJSON, authData)
+			},
+		},
+		{
+			name: "wrong ceremony",
+			assert: func() ([]byte, []byte, []byte) {
+				authenticator.signCount++
+				clientDataJSON := authenticator.clientData("webauthn.create", challenge, testRelyingParty.Origin)
+				authData := authenticator.authData(testRelyingParty.ID, authenticator.flags)
+				return clientDataJSON, authData, authenticator.sign(clientDataJSON, authData)
+			},
+		},
+		{
+			name: "wrong relying party",
+			assert: func() ([]byte, []byte, []byte) {
+				authenticator.signCount++
+				clientDataJSON := authenticator.clientData("webauthn.get", challenge, testRelyingParty.Origin)
+				authData := authenticator.authData("evil.example", authenticator.flags)
+				return clientDataJSON, authData, authenticator.sign(clientDataJSON, authData)
+			},
+		},
+		{
+			name: "user not verified",
+			assert: func() ([]byte, []byte, []byte) {
+				authenticator.signCount++
+				clientDataJSON := authenticator.clientData("webauthn.get", challenge, testRelyingParty.Origin)
+				authData := authenticator.authData(testRelyingParty.ID, webAuthnFlagUserPresent)
+				return clientDataJSON, authData, authenticator.sign(clientDataJSON, authData)
+			},
+		},
+		{
+			name: "signed by another key",
+			assert: func() ([]byte, []byte, []byte) {
+				other.signCount = authenticator.signCount + 1
+				return other.get(challenge)
+			},
+		},
+		{
+			name: "modified authenticator data",
+			assert: func() ([]byte, []byte, []byte) {
+				clientDataJSON, authData, signature := authenticator.get(challenge)
+				authData[36]++
+				return clientDataJSON, authData, signature
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientDataJSON, authData, signature := tt.assert()
+			if _, err := testRelyingParty.VerifyAssertion(challenge, credential.PublicKey, 0, clientDataJSON, authData, signature); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestWebAuthnRegistrationRejectsAttestationFormats(t *testing.T) {
+	authenticator := newSoftAuthenticator(t)
+	challenge, _ := NewWebAuthnChallenge()
+	clientDataJSON, attestationObject := authenticator.create(challenge)
+
+	decoded, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		t.Fatalf("decodeCBOR() error = %v", err)
+	}
+	attestation := decoded.(map[interface{}]interface{})
+	attestation["fmt"] = "packed"
+
+	if _, err := testRelyingParty.VerifyRegistration(challenge, clientDataJSON, encodeTestCBOR(attestation)); err == nil {
+		t.Fatal("expected error for packed attestation")
+	}
+
+	otherChallenge, _ := NewWebAuthnChallenge()
+	if _, err := testRelyingParty.VerifyRegistration(otherChallenge, clientDataJSON, attestationObject); !errors.Is(err, ErrWebAuthnChallenge) {
+		t.Fatalf("VerifyRegistration() error = %v, want %v", err, ErrWebAuthnChallenge)
+	}
+}
@@ -7,31 +7,96 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const chirpIsReferenced = `-- name: ChirpIsReferenced :one
+SELECT EXISTS (
+  SELECT 1 FROM chirps
+  WHERE parent_id = $1::uuid OR quote_of_id = $1::uuid
+)::boolean AS is_referenced
+`
+
+func (q *Queries) ChirpIsReferenced(ctx context.Context, id uuid.UUID) (bool, error) {
+	row := q.db.QueryRowContext(ctx, chirpIsReferenced, id)
+	var isReferenced bool
+	err := row.Scan(&isReferenced)
+	return isReferenced, err
+}
+
 const createChirp = `-- name: CreateChirp :one
 INSERT INTO chirps (
-  id, created_at, updated_at, body, user_id
+  id, created_at, updated_at, body, user_id, parent_id, quote_of_id
 )
 VALUES (
   gen_random_uuid(),
   NOW(),
   NOW(),
   $1,
-  $2
+  $2,
+  $3,
+  $4
 )
-RETURNING id, created_at, updated_at, body, user_id
+RETURNING id, created_at, updated_at, body, user_id, search_vector, parent_id, deleted_at, rechirp_of_id, quote_of_id
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+	Body      string
+	UserID    uuid.UUID
+	ParentID  uuid.NullUUID
+	QuoteOfID uuid.NullUUID
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp,
+		arg.Body,
+		arg.UserID,
+		arg.ParentID,
+		arg.QuoteOfID,
+	)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.SearchVector,
+		&i.ParentID,
+		&i.DeletedAt,
+		&i.RechirpOfID,
+		&i.QuoteOfID,
+	)
+	return i, err
+}
+
+const createRechirp = `-- name: CreateRechirp :one
+INSERT INTO chirps (
+  id, created_at, updated_at, body, user_id, rechirp_of_id
+)
+VALUES (
+  gen_random_uuid(),
+  NOW(),
+  NOW(),
+  '',
+  $1,
+  $2
+)
+ON CONFLICT (user_id, rechirp_of_id) WHERE rechirp_of_id IS NOT NULL DO NOTHING
+RETURNING id, created_at, updated_at, body, user_id, search_vector, parent_id, deleted_at, rechirp_of_id, quote_of_id
+`
+
+type CreateRechirpParams struct {
+	UserID      uuid.UUID
+	RechirpOfID uuid.NullUUID
+}
+
+func (q *Queries) CreateRechirp(ctx context.Context, arg CreateRechirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, createRechirp, arg.UserID, arg.RechirpOfID)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -39,6 +104,11 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.SearchVector,
+		&i.ParentID,
+		&i.DeletedAt,
+		&i.RechirpOfID,
+		&i.QuoteOfID,
 	)
 	return i, err
 }
@@ -53,8 +123,36 @@ func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
 	return err
 }
 
+const deleteRechirp = `-- name: DeleteRechirp :execrows
+DELETE FROM chirps
+WHERE user_id = $1 AND rechirp_of_id = $2
+`
+
+type DeleteRechirpParams struct {
+	UserID      uuid.UUID
+	RechirpOfID uuid.NullUUID
+}
+
+func (q *Queries) DeleteRechirp(ctx context.Context, arg DeleteRechirpParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteRechirp, arg.UserID, arg.RechirpOfID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteRechirpsOf = `-- name: DeleteRechirpsOf :exec
+DELETE FROM chirps
+WHERE rechirp_of_id = $1
+`
+
+func (q *Queries) DeleteRechirpsOf(ctx context.Context, rechirpOfID uuid.NullUUID) error {
+	_, err := q.db.ExecContext(ctx, deleteRechirpsOf, rechirpOfID)
+	return err
+}
+
 const getChirpById = `-- name: GetChirpById :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps
+SELECT id, created_at, updated_at, body, user_id, search_vector, parent_id, deleted_at, rechirp_of_id, quote_of_id FROM chirps
 WHERE id = $1
 `
 
@@ -67,17 +165,291 @@ func (q *Queries) GetChirpById(ctx context.Context, id uuid.UUID) (Chirp, error)
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.SearchVector,
+		&i.ParentID,
+		&i.DeletedAt,
+		&i.RechirpOfID,
+		&i.QuoteOfID,
+	)
+	return i, err
+}
+
+const getChirpByIdForUpdate = `-- name: GetChirpByIdForUpdate :one
+SELECT id, created_at, updated_at, body, user_id, search_vector, parent_id, deleted_at, rechirp_of_id, quote_of_id FROM chirps
+WHERE id = $1
+FOR UPDATE
+`
+
+func (q *Queries) GetChirpByIdForUpdate(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirpByIdForUpdate, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.SearchVector,
+		&i.ParentID,
+		&i.DeletedAt,
+		&i.RechirpOfID,
+		&i.QuoteOfID,
 	)
 	return i, err
 }
 
-const getChirps = `-- name: GetChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
-ORDER BY created_at ASC
+const getChirpThread = `-- name: GetChirpThread :many
+WITH RECURSIVE ancestors AS (
+  SELECT chirps.id, chirps.parent_id FROM chirps
+  WHERE chirps.id = $1
+  UNION ALL
+  SELECT chirps.id, chirps.parent_id FROM chirps
+  JOIN ancestors ON chirps.id = ancestors.parent_id
+), thread AS (
+  SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.search_vector, chirps.parent_id, chirps.deleted_at, chirps.rechirp_of_id, chirps.quote_of_id FROM chirps
+  WHERE chirps.id = (SELECT ancestors.id FROM ancestors WHERE ancestors.parent_id IS NULL)
+  UNION ALL
+  SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.search_vector, chirps.parent_id, chirps.deleted_at, chirps.rechirp_of_id, chirps.quote_of_id FROM chirps
+  JOIN thread ON chirps.parent_id = thread.id
+)
+SELECT id, created_at, updated_at, body, user_id, search_vector, parent_id, deleted_at, rechirp_of_id, quote_of_id FROM thread
+ORDER BY created_at ASC, id ASC
+`
+
+type GetChirpThreadRow struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Body         string
+	UserID       uuid.UUID
+	SearchVector interface{}
+	ParentID     uuid.NullUUID
+	DeletedAt    sql.NullTime
+	RechirpOfID  uuid.NullUUID
+	QuoteOfID    uuid.NullUUID
+}
+
+func (q *Queries) GetChirpThread(ctx context.Context, id uuid.UUID) ([]GetChirpThreadRow, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpThread, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetChirpThreadRow
+	for rows.Next() {
+		var i GetChirpThreadRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.ParentID,
+			&i.DeletedAt,
+			&i.RechirpOfID,
+			&i.QuoteOfID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpsByIds = `-- name: GetChirpsByIds :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, parent_id, deleted_at, rechirp_of_id, quote_of_id FROM chirps
+WHERE id = ANY($1::uuid[])
+`
+
+func (q *Queries) GetChirpsByIds(ctx context.Context, ids []uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByIds, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.ParentID,
+			&i.DeletedAt,
+			&i.RechirpOfID,
+			&i.QuoteOfID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsAfter = `-- name: ListChirpsAfter :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, parent_id, deleted_at, rechirp_of_id, quote_of_id FROM chirps
+WHERE deleted_at IS NULL
+  AND ($1::uuid IS NULL OR user_id = $1::uuid)
+  AND ($2::uuid IS NULL OR parent_id = $2::uuid)
+  AND (
+    $3::timestamp IS NULL
+    OR (created_at, id) > ($3::timestamp, $4::uuid)
+  )
+ORDER BY created_at ASC, id ASC
+LIMIT $5
+`
+
+type ListChirpsAfterParams struct {
+	AuthorID        uuid.NullUUID
+	ParentID        uuid.NullUUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	RowLimit        int32
+}
+
+func (q *Queries) ListChirpsAfter(ctx context.Context, arg ListChirpsAfterParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsAfter,
+		arg.AuthorID,
+		arg.ParentID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.ParentID,
+			&i.DeletedAt,
+			&i.RechirpOfID,
+			&i.QuoteOfID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsBefore = `-- name: ListChirpsBefore :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, parent_id, deleted_at, rechirp_of_id, quote_of_id FROM chirps
+WHERE deleted_at IS NULL
+  AND ($1::uuid IS NULL OR user_id = $1::uuid)
+  AND ($2::uuid IS NULL OR parent_id = $2::uuid)
+  AND (
+    $3::timestamp IS NULL
+    OR (created_at, id) < ($3::timestamp, $4::uuid)
+  )
+ORDER BY created_at DESC, id DESC
+LIMIT $5
 `
 
-func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirps)
+type ListChirpsBeforeParams struct {
+	AuthorID        uuid.NullUUID
+	ParentID        uuid.NullUUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	RowLimit        int32
+}
+
+func (q *Queries) ListChirpsBefore(ctx context.Context, arg ListChirpsBeforeParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsBefore,
+		arg.AuthorID,
+		arg.ParentID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.ParentID,
+			&i.DeletedAt,
+			&i.RechirpOfID,
+			&i.QuoteOfID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listHashtagChirpsAfter = `-- name: ListHashtagChirpsAfter :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, parent_id, deleted_at, rechirp_of_id, quote_of_id FROM chirps
+WHERE deleted_at IS NULL
+  AND id IN (SELECT chirp_id FROM chirp_hashtags WHERE tag = $1)
+  AND (
+    $2::timestamp IS NULL
+    OR (created_at, id) > ($2::timestamp, $3::uuid)
+  )
+ORDER BY created_at ASC, id ASC
+LIMIT $4
+`
+
+type ListHashtagChirpsAfterParams struct {
+	Tag             string
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	RowLimit        int32
+}
+
+func (q *Queries) ListHashtagChirpsAfter(ctx context.Context, arg ListHashtagChirpsAfterParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listHashtagChirpsAfter,
+		arg.Tag,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.RowLimit,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -91,6 +463,11 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.SearchVector,
+			&i.ParentID,
+			&i.DeletedAt,
+			&i.RechirpOfID,
+			&i.QuoteOfID,
 		); err != nil {
 			return nil, err
 		}
@@ -105,14 +482,32 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 	return items, nil
 }
 
-const getChirpsByAuthor = `-- name: GetChirpsByAuthor :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
-WHERE user_id = $1
-ORDER BY created_at ASC
+const listHashtagChirpsBefore = `-- name: ListHashtagChirpsBefore :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, parent_id, deleted_at, rechirp_of_id, quote_of_id FROM chirps
+WHERE deleted_at IS NULL
+  AND id IN (SELECT chirp_id FROM chirp_hashtags WHERE tag = $1)
+  AND (
+    $2::timestamp IS NULL
+    OR (created_at, id) < ($2::timestamp, $3::uuid)
+  )
+ORDER BY created_at DESC, id DESC
+LIMIT $4
 `
 
-func (q *Queries) GetChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirpsByAuthor, userID)
+type ListHashtagChirpsBeforeParams struct {
+	Tag             string
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	RowLimit        int32
+}
+
+func (q *Queries) ListHashtagChirpsBefore(ctx context.Context, arg ListHashtagChirpsBeforeParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listHashtagChirpsBefore,
+		arg.Tag,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.RowLimit,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -126,6 +521,11 @@ func (q *Queries) GetChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([]Ch
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.SearchVector,
+			&i.ParentID,
+			&i.DeletedAt,
+			&i.RechirpOfID,
+			&i.QuoteOfID,
 		); err != nil {
 			return nil, err
 		}
@@ -139,3 +539,379 @@ func (q *Queries) GetChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([]Ch
 	}
 	return items, nil
 }
+
+const listMentionChirpsAfter = `-- name: ListMentionChirpsAfter :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, parent_id, deleted_at, rechirp_of_id, quote_of_id FROM chirps
+WHERE deleted_at IS NULL
+  AND id IN (SELECT chirp_id FROM chirp_mentions WHERE chirp_mentions.user_id = $1)
+  AND (
+    $2::timestamp IS NULL
+    OR (created_at, id) > ($2::timestamp, $3::uuid)
+  )
+ORDER BY created_at ASC, id ASC
+LIMIT $4
+`
+
+type ListMentionChirpsAfterParams struct {
+	UserID          uuid.UUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	RowLimit        int32
+}
+
+func (q *Queries) ListMentionChirpsAfter(ctx context.Context, arg ListMentionChirpsAfterParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listMentionChirpsAfter,
+		arg.UserID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.ParentID,
+			&i.DeletedAt,
+			&i.RechirpOfID,
+			&i.QuoteOfID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listMentionChirpsBefore = `-- name: ListMentionChirpsBefore :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, parent_id, deleted_at, rechirp_of_id, quote_of_id FROM chirps
+WHERE deleted_at IS NULL
+  AND id IN (SELECT chirp_id FROM chirp_mentions WHERE chirp_mentions.user_id = $1)
+  AND (
+    $2::timestamp IS NULL
+    OR (created_at, id) < ($2::timestamp, $3::uuid)
+  )
+ORDER BY created_at DESC, id DESC
+LIMIT $4
+`
+
+type ListMentionChirpsBeforeParams struct {
+	UserID          uuid.UUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	RowLimit        int32
+}
+
+func (q *Queries) ListMentionChirpsBefore(ctx context.Context, arg ListMentionChirpsBeforeParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listMentionChirpsBefore,
+		arg.UserID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.ParentID,
+			&i.DeletedAt,
+			&i.RechirpOfID,
+			&i.QuoteOfID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTimelineAfter = `-- name: ListTimelineAfter :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, parent_id, deleted_at, rechirp_of_id, quote_of_id FROM chirps
+WHERE deleted_at IS NULL
+  AND (
+    user_id = $1
+    OR user_id IN (SELECT followee_id FROM follows WHERE follower_id = $1)
+  )
+  AND (
+    $2::timestamp IS NULL
+    OR (created_at, id) > ($2::timestamp, $3::uuid)
+  )
+ORDER BY created_at ASC, id ASC
+LIMIT $4
+`
+
+type ListTimelineAfterParams struct {
+	UserID          uuid.UUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	RowLimit        int32
+}
+
+func (q *Queries) ListTimelineAfter(ctx context.Context, arg ListTimelineAfterParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listTimelineAfter,
+		arg.UserID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.ParentID,
+			&i.DeletedAt,
+			&i.RechirpOfID,
+			&i.QuoteOfID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTimelineBefore = `-- name: ListTimelineBefore :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, parent_id, deleted_at, rechirp_of_id, quote_of_id FROM chirps
+WHERE deleted_at IS NULL
+  AND (
+    user_id = $1
+    OR user_id IN (SELECT followee_id FROM follows WHERE follower_id = $1)
+  )
+  AND (
+    $2::timestamp IS NULL
+    OR (created_at, id) < ($2::timestamp, $3::uuid)
+  )
+ORDER BY created_at DESC, id DESC
+LIMIT $4
+`
+
+type ListTimelineBeforeParams struct {
+	UserID          uuid.UUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	RowLimit        int32
+}
+
+func (q *Queries) ListTimelineBefore(ctx context.Context, arg ListTimelineBeforeParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listTimelineBefore,
+		arg.UserID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.ParentID,
+			&i.DeletedAt,
+			&i.RechirpOfID,
+			&i.QuoteOfID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserChirps = `-- name: ListUserChirps :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, parent_id, deleted_at, rechirp_of_id, quote_of_id
+FROM chirps
+WHERE user_id = $1 AND deleted_at IS NULL
+ORDER BY created_at ASC, id ASC
+`
+
+func (q *Queries) ListUserChirps(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listUserChirps, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.ParentID,
+			&i.DeletedAt,
+			&i.RechirpOfID,
+			&i.QuoteOfID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const searchChirps = `-- name: SearchChirps :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, parent_id, deleted_at, rechirp_of_id, quote_of_id FROM chirps
+WHERE search_vector @@ to_tsquery('english', $1)
+  AND deleted_at IS NULL
+  AND ($2::uuid IS NULL OR user_id = $2::uuid)
+ORDER BY ts_rank_cd(search_vector, to_tsquery('english', $1)) DESC, created_at DESC, id DESC
+LIMIT $3
+OFFSET $4
+`
+
+type SearchChirpsParams struct {
+	Query     string
+	AuthorID  uuid.NullUUID
+	RowLimit  int32
+	RowOffset int32
+}
+
+func (q *Queries) SearchChirps(ctx context.Context, arg SearchChirpsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, searchChirps,
+		arg.Query,
+		arg.AuthorID,
+		arg.RowLimit,
+		arg.RowOffset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.ParentID,
+			&i.DeletedAt,
+			&i.RechirpOfID,
+			&i.QuoteOfID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const tombstoneChirp = `-- name: TombstoneChirp :exec
+UPDATE chirps
+SET body = '', deleted_at = NOW(), updated_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) TombstoneChirp(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, tombstoneChirp, id)
+	return err
+}
+
+const updateChirpBody = `-- name: UpdateChirpBody :one
+UPDATE chirps
+SET body = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, body, user_id, search_vector, parent_id, deleted_at, rechirp_of_id, quote_of_id
+`
+
+type UpdateChirpBodyParams struct {
+	ID   uuid.UUID
+	Body string
+}
+
+func (q *Queries) UpdateChirpBody(ctx context.Context, arg UpdateChirpBodyParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, updateChirpBody, arg.ID, arg.Body)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.SearchVector,
+		&i.ParentID,
+		&i.DeletedAt,
+		&i.RechirpOfID,
+		&i.QuoteOfID,
+	)
+	return i, err
+}
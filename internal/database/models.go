@@ -12,27 +12,179 @@ import (
 )
 
 type Chirp struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Body         string
+	UserID       uuid.UUID
+	SearchVector interface{}
+	ParentID     uuid.NullUUID
+	DeletedAt    sql.NullTime
+	RechirpOfID  uuid.NullUUID
+	QuoteOfID    uuid.NullUUID
+}
+
+type ChirpHashtag struct {
+	ChirpID   uuid.UUID
+	Tag       string
+	CreatedAt time.Time
+}
+
+type ChirpMention struct {
+	ChirpID     uuid.UUID
+	UserID      uuid.UUID
+	StartOffset int32
+	Length      int32
+}
+
+type ChirpRevision struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
-	UpdatedAt time.Time
+	ChirpID   uuid.UUID
 	Body      string
+}
+
+type EmailVerificationToken struct {
+	ID        uuid.UUID
 	UserID    uuid.UUID
+	Email     string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type Follow struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+	CreatedAt  time.Time
+}
+
+type Like struct {
+	UserID    uuid.UUID
+	ChirpID   uuid.UUID
+	CreatedAt time.Time
+}
+
+type MfaChallenge struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	Attempts  int32
+	UsedAt    sql.NullTime
+}
+
+type ModerationAction struct {
+	ID             uuid.UUID
+	ModeratorID    uuid.NullUUID
+	Action         string
+	TargetUserID   uuid.NullUUID
+	TargetChirpID  uuid.NullUUID
+	Reason         string
+	SuspendedUntil sql.NullTime
+	CreatedAt      time.Time
+	ReportID       uuid.NullUUID
+}
+
+type PasswordResetToken struct {
+	TokenHash string
+	UserID    uuid.UUID
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type PersonalAccessToken struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	Name       string
+	TokenHash  string
+	Scopes     []string
+	CreatedAt  time.Time
+	ExpiresAt  sql.NullTime
+	LastUsedAt sql.NullTime
+	RevokedAt  sql.NullTime
+}
+
+type RecoveryCode struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	CodeHash  string
+	CreatedAt time.Time
+	UsedAt    sql.NullTime
 }
 
 type RefreshToken struct {
-	Token     string
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	ExpiresAt time.Time
 	RevokedAt sql.NullTime
 	UserID    uuid.UUID
+	FamilyID  uuid.UUID
+	ID        string
+	TokenHash string
+}
+
+type Report struct {
+	ID         uuid.UUID
+	ReporterID uuid.UUID
+	ChirpID    uuid.NullUUID
+	UserID     uuid.NullUUID
+	Category   string
+	Details    string
+	Status     string
+	AssigneeID uuid.NullUUID
+	Resolution string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	ClaimedAt  sql.NullTime
+	ClosedAt   sql.NullTime
+}
+
+type Session struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	CreatedAt time.Time
+	UserAgent string
+	IpAddress string
 }
 
 type User struct {
-	ID             uuid.UUID
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
-	IsChirpyRed    sql.NullBool
+	ID               uuid.UUID
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	Email            string
+	HashedPassword   string
+	IsChirpyRed      sql.NullBool
+	Handle           sql.NullString
+	DisplayName      string
+	Bio              string
+	AvatarUrl        string
+	EmailVerifiedAt  sql.NullTime
+	TotpSecret       sql.NullString
+	TotpEnabledAt    sql.NullTime
+	TotpLastUsedStep sql.NullInt64
+	Role             string
+	SuspendedUntil   sql.NullTime
+	BannedAt         sql.NullTime
+}
+
+type WebauthnChallenge struct {
+	ID        uuid.UUID
+	UserID    uuid.NullUUID
+	Purpose   string
+	Challenge []byte
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+type WebauthnCredential struct {
+	ID           uuid.UUID
+	UserID       uuid.UUID
+	CredentialID []byte
+	PublicKey    []byte
+	SignCount    int64
+	Name         string
+	CreatedAt    time.Time
+	LastUsedAt   sql.NullTime
 }
@@ -15,50 +15,109 @@ import (
 
 const createRefreshToken = `-- name: CreateRefreshToken :exec
 INSERT INTO refresh_tokens (
-  token, created_at, updated_at, expires_at, revoked_at, user_id
+  id, token_hash, created_at, updated_at, expires_at, revoked_at, user_id, family_id
 )
 VALUES (
-  $1, NOW(), NOW(), $2, NULL, $3
+  $1, $2, NOW(), NOW(), $3, NULL, $4, $5
 )
 `
 
 type CreateRefreshTokenParams struct {
-	Token     string
+	ID        string
+	TokenHash string
 	ExpiresAt time.Time
 	UserID    uuid.UUID
+	FamilyID  uuid.UUID
 }
 
 func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) error {
-	_, err := q.db.ExecContext(ctx, createRefreshToken, arg.Token, arg.ExpiresAt, arg.UserID)
+	_, err := q.db.ExecContext(ctx, createRefreshToken,
+		arg.ID,
+		arg.TokenHash,
+		arg.ExpiresAt,
+		arg.UserID,
+		arg.FamilyID,
+	)
 	return err
 }
 
 const getUserFromRefreshToken = `-- name: GetUserFromRefreshToken :one
-SELECT user_id, expires_at, revoked_at
+SELECT refresh_tokens.user_id, refresh_tokens.expires_at, refresh_tokens.revoked_at, refresh_tokens.family_id, refresh_tokens.token_hash, users.role, users.suspended_until, users.banned_at
 FROM refresh_tokens
-WHERE token = $1
+JOIN users ON users.id = refresh_tokens.user_id
+WHERE refresh_tokens.id = $1
 `
 
 type GetUserFromRefreshTokenRow struct {
-	UserID    uuid.UUID
-	ExpiresAt time.Time
-	RevokedAt sql.NullTime
+	UserID         uuid.UUID
+	ExpiresAt      time.Time
+	RevokedAt      sql.NullTime
+	FamilyID       uuid.UUID
+	TokenHash      string
+	Role           string
+	SuspendedUntil sql.NullTime
+	BannedAt       sql.NullTime
 }
 
-func (q *Queries) GetUserFromRefreshToken(ctx context.Context, token string) (GetUserFromRefreshTokenRow, error) {
-	row := q.db.QueryRowContext(ctx, getUserFromRefreshToken, token)
+func (q *Queries) GetUserFromRefreshToken(ctx context.Context, id string) (GetUserFromRefreshTokenRow, error) {
+	row := q.db.QueryRowContext(ctx, getUserFromRefreshToken, id)
 	var i GetUserFromRefreshTokenRow
-	err := row.Scan(&i.UserID, &i.ExpiresAt, &i.RevokedAt)
+	err := row.Scan(
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.FamilyID,
+		&i.TokenHash,
+		&i.Role,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+	)
 	return i, err
 }
 
+const revokeActiveRefreshToken = `-- name: RevokeActiveRefreshToken :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeActiveRefreshToken(ctx context.Context, id string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeActiveRefreshToken, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const revokeRefreshToken = `-- name: RevokeRefreshToken :exec
 UPDATE refresh_tokens
 SET revoked_at = NOW(), updated_at = NOW()
-WHERE token = $1
+WHERE id = $1
+`
+
+func (q *Queries) RevokeRefreshToken(ctx context.Context, id string) error {
+	_, err := q.db.ExecContext(ctx, revokeRefreshToken, id)
+	return err
+}
+
+const revokeRefreshTokenFamily = `-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE family_id = $1 AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeRefreshTokenFamily, familyID)
+	return err
+}
+
+const revokeUserRefreshTokens = `-- name: RevokeUserRefreshTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL
 `
 
-func (q *Queries) RevokeRefreshToken(ctx context.Context, token string) error {
-	_, err := q.db.ExecContext(ctx, revokeRefreshToken, token)
+func (q *Queries) RevokeUserRefreshTokens(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeUserRefreshTokens, userID)
 	return err
 }
@@ -0,0 +1,166 @@
+package mailer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatMessage(t *testing.T) {
+	date := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	msg := Message{To: "user@example.com", Subject: "Hello", Body: "line one\nline two"}
+
+	data, err := FormatMessage("chirpy@example.com", msg, date)
+	if err != nil {
+		t.Fatalf("FormatMessage() error = %v", err)
+	}
+
+	want := "From: chirpy@example.com\r\n" +
+		"To: user@example.com\r\n" +
+		"Subject: Hello\r\n" +
+		"Date: Tue, 02 Jan 2024 03:04:05 +0000\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" +
+		"line one\r\nline two\r\n"
+	if string(data) != want {
+		t.Fatalf("FormatMessage() got %q, want %q", data, want)
+	}
+}
+
+func TestFormatMessageRejectsHeaderInjection(t *testing.T) {
+	msg := Message{To: "user@example.com\r\nBcc: other@example.com", Subject: "Hello"}
+
+	if _, err := FormatMessage("chirpy@example.com", msg, time.Now()); err == nil {
+		t.Fatalf("FormatMessage() expected error for header with line break")
+	}
+}
+
+func TestLogMailer(t *testing.T) {
+	var buf bytes.Buffer
+	m := NewLogMailer(&buf)
+
+	if err := m.Send(context.Background(), Message{To: "user@example.com", Subject: "Hello", Body: "Hi there"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{"To: user@example.com", "Subject: Hello", "Hi there"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("LogMailer output %q missing %q", out, want)
+		}
+	}
+}
+
+// serveSMTP accepts one connection on a new listener and hands it to
+// handle, returning the listener's address.
+func serveSMTP(t *testing.T, handle func(conn net.Conn)) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		handle(conn)
+	}()
+	return ln.Addr().String()
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	received := make(chan string, 1)
+	addr := serveSMTP(t, func(conn net.Conn) {
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+		reply("220 localhost ESMTP")
+		var data strings.Builder
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"):
+				reply("250 localhost")
+			case strings.HasPrefix(cmd, "MAIL"), strings.HasPrefix(cmd, "RCPT"):
+				reply("250 OK")
+			case cmd == "DATA":
+				reply("354 Go ahead")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				received <- data.String()
+				reply("250 OK")
+			case cmd == "QUIT":
+				reply("221 Bye")
+				return
+			default:
+				reply("500 Unknown command")
+			}
+		}
+	})
+
+	m := NewSMTPMailer(addr, "chirpy@example.com", "", "")
+	if err := m.Send(context.Background(), Message{To: "user@example.com", Subject: "Hello", Body: "Hi there"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	if got := <-received; !strings.Contains(got, "Subject: Hello") || !strings.Contains(got, "Hi there") {
+		t.Fatalf("server received %q", got)
+	}
+}
+
+func TestSMTPMailerSendStopsAtDeadline(t *testing.T) {
+	// The server accepts the connection and never greets the client.
+	addr := serveSMTP(t, func(conn net.Conn) {
+		io.Copy(io.Discard, conn)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := NewSMTPMailer(addr, "chirpy@example.com", "", "").Send(ctx, Message{To: "user@example.com", Subject: "Hello"})
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Send() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Send() took %v to give up", elapsed)
+	}
+}
+
+func TestSMTPMailerSendStopsWhenCancelled(t *testing.T) {
+	addr := serveSMTP(t, func(conn net.Conn) {
+		io.Copy(io.Discard, conn)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	err := NewSMTPMailer(addr, "chirpy@example.com", "", "").Send(ctx, Message{To: "user@example.com", Subject: "Hello"})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Send() error = %v, want %v", err, context.Canceled)
+	}
+}
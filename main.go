@@ -1,12 +1,17 @@
 package main
 
 import (
+	"crypto/ed25519"
 	"database/sql"
+	"errors"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 
+	"github.com/glebson1988/chirpy/internal/auth"
 	"github.com/glebson1988/chirpy/internal/database"
+	"github.com/glebson1988/chirpy/internal/mailer"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
@@ -15,9 +20,47 @@ func main() {
 	_ = godotenv.Load()
 
 	dbURL := os.Getenv("DB_URL")
+	if len(os.Args) > 1 {
+		if err := runCommand(dbURL, os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	platform := os.Getenv("PLATFORM")
 	bearerToken := os.Getenv("BEARER_TOKEN")
 	polkaKey := os.Getenv("POLKA_KEY")
+	baseURL := os.Getenv("BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8080"
+	}
+	requireEmailVerification := os.Getenv("REQUIRE_EMAIL_VERIFICATION") == "true"
+
+	// Passkeys are bound to the site's domain and origin, which default to
+	// those of BASE_URL.
+	parsedBaseURL, err := url.Parse(baseURL)
+	if err != nil {
+		log.Fatalf("Invalid BASE_URL: %v", err)
+	}
+	webauthnRPID := os.Getenv("WEBAUTHN_RP_ID")
+	if webauthnRPID == "" {
+		webauthnRPID = parsedBaseURL.Hostname()
+	}
+	webauthnOrigin := os.Getenv("WEBAUTHN_ORIGIN")
+	if webauthnOrigin == "" {
+		webauthnOrigin = parsedBaseURL.Scheme + "://" + parsedBaseURL.Host
+	}
+
+	tokenKeys, err := loadTokenKeys(baseURL, bearerToken)
+	if err != nil {
+		log.Fatalf("Failed to load JWT keys: %v", err)
+	}
+
+	var mail mailer.Mailer = mailer.NewLogMailer(os.Stdout)
+	if smtpAddr := os.Getenv("SMTP_ADDR"); smtpAddr != "" {
+		mail = mailer.NewSMTPMailer(smtpAddr, os.Getenv("SMTP_FROM"), os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"))
+	}
+
 	db, err := sql.Open("postgres", dbURL)
 	if err != nil {
 		log.Fatalf("Failed to connect to DB: %v", err)
@@ -28,29 +71,94 @@ func main() {
 	const port = "8080"
 
 	cfg := &apiConfig{
-		db:          dbQueries,
-		platform:    platform,
-		tokenSecret: bearerToken,
-		tokenStore:  dbQueries,
-		userStore:   dbQueries,
-		polkaKey:    polkaKey,
+		db:         dbQueries,
+		dbConn:     db,
+		platform:   platform,
+		tokenKeys:  tokenKeys,
+		tokenStore: dbQueries,
+		userStore:  dbQueries,
+		polkaKey:   polkaKey,
+		mailer:     mail,
+		baseURL:    baseURL,
+		webauthn: auth.WebAuthnRelyingParty{
+			ID:     webauthnRPID,
+			Name:   "Chirpy",
+			Origin: webauthnOrigin,
+		},
+
+		requireEmailVerification: requireEmailVerification,
 	}
 
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("GET /api/healthz", cfg.handlerHealthz)
-	mux.HandleFunc("GET /admin/metrics", cfg.handlerMetrics)
-	mux.HandleFunc("GET /api/chirps", cfg.handlerListChirps)
-	mux.HandleFunc("POST /admin/reset", cfg.handlerReset)
-	mux.HandleFunc("POST /api/chirps", cfg.handlerCreateChirp)
+	mux.HandleFunc("GET /.well-known/jwks.json", cfg.handlerJWKS)
+	mux.Handle("GET /admin/metrics", cfg.middlewareAuth(auth.ScopeAccount, cfg.middlewareRequireRole(auth.RoleAdmin, http.HandlerFunc(cfg.handlerMetrics))))
+	mux.Handle("GET /api/chirps", cfg.middlewareOptionalAuth(auth.ScopeChirpsRead, http.HandlerFunc(cfg.handlerListChirps)))
+	mux.Handle("POST /admin/reset", cfg.middlewareAuth(auth.ScopeAccount, cfg.middlewareRequireRole(auth.RoleAdmin, http.HandlerFunc(cfg.handlerReset))))
+	mux.Handle("POST /api/chirps", cfg.middlewareAuth(auth.ScopeChirpsWrite, http.HandlerFunc(cfg.handlerCreateChirp)))
 	mux.HandleFunc("POST /api/login", cfg.handlerLogin)
+	mux.HandleFunc("POST /api/login/mfa", cfg.handlerLoginMFA)
+	mux.HandleFunc("POST /api/login/passkey/begin", cfg.handlerBeginPasskeyLogin)
+	mux.HandleFunc("POST /api/login/passkey/finish", cfg.handlerFinishPasskeyLogin)
+	mux.Handle("GET /api/passkeys", cfg.middlewareAuth(auth.ScopeAccount, http.HandlerFunc(cfg.handlerListPasskeys)))
+	mux.Handle("POST /api/passkeys/register/begin", cfg.middlewareAuth(auth.ScopeAccount, http.HandlerFunc(cfg.handlerBeginPasskeyRegistration)))
+	mux.Handle("POST /api/passkeys/register/finish", cfg.middlewareAuth(auth.ScopeAccount, http.HandlerFunc(cfg.handlerFinishPasskeyRegistration)))
+	mux.Handle("DELETE /api/passkeys/{passkeyID}", cfg.middlewareAuth(auth.ScopeAccount, http.HandlerFunc(cfg.handlerDeletePasskey)))
+	mux.Handle("POST /api/mfa/totp/enroll", cfg.middlewareAuth(auth.ScopeAccount, http.HandlerFunc(cfg.handlerEnrollTOTP)))
+	mux.Handle("POST /api/mfa/totp/confirm", cfg.middlewareAuth(auth.ScopeAccount, http.HandlerFunc(cfg.handlerConfirmTOTP)))
+	mux.Handle("DELETE /api/mfa/totp", cfg.middlewareAuth(auth.ScopeAccount, http.HandlerFunc(cfg.handlerDisableTOTP)))
 	mux.HandleFunc("POST /api/refresh", cfg.handlerRefresh)
 	mux.HandleFunc("POST /api/revoke", cfg.handlerRevoke)
+	mux.Handle("POST /api/tokens", cfg.middlewareAuth(auth.ScopeAccount, http.HandlerFunc(cfg.handlerCreatePersonalAccessToken)))
+	mux.Handle("GET /api/tokens", cfg.middlewareAuth(auth.ScopeAccount, http.HandlerFunc(cfg.handlerListPersonalAccessTokens)))
+	mux.Handle("DELETE /api/tokens/{tokenID}", cfg.middlewareAuth(auth.ScopeAccount, http.HandlerFunc(cfg.handlerRevokePersonalAccessToken)))
+	mux.Handle("GET /api/sessions", cfg.middlewareAuth(auth.ScopeAccount, http.HandlerFunc(cfg.handlerListSessions)))
+	mux.Handle("DELETE /api/sessions/{sessionID}", cfg.middlewareAuth(auth.ScopeAccount, http.HandlerFunc(cfg.handlerRevokeSession)))
+	mux.Handle("POST /api/sessions/revoke-all", cfg.middlewareAuth(auth.ScopeAccount, http.HandlerFunc(cfg.handlerRevokeAllSessions)))
+	mux.HandleFunc("POST /api/password/forgot", cfg.handlerForgotPassword)
+	mux.HandleFunc("POST /api/password/reset", cfg.handlerResetPassword)
 	mux.HandleFunc("POST /api/users", cfg.handlerCreateUser)
-	mux.HandleFunc("PUT /api/users", cfg.handlerUpdateUser)
+	// Deprecated: PUT /api/users predates PATCH /api/users/me and is kept
+	// for existing clients.
+	mux.Handle("PUT /api/users", cfg.middlewareAuth(auth.ScopeAccount, http.HandlerFunc(cfg.handlerPatchUser)))
+	mux.Handle("PATCH /api/users/me", cfg.middlewareAuth(auth.ScopeUsersWrite, http.HandlerFunc(cfg.handlerPatchUser)))
+	mux.Handle("DELETE /api/users/me", cfg.middlewareAuth(auth.ScopeAccount, http.HandlerFunc(cfg.handlerDeleteUser)))
+	mux.Handle("GET /api/users/me/export", cfg.middlewareAuth(auth.ScopeAccount, http.HandlerFunc(cfg.handlerExportUser)))
+	mux.Handle("POST /api/users/me/verification-email", cfg.middlewareAuth(auth.ScopeAccount, http.HandlerFunc(cfg.handlerResendVerificationEmail)))
+	mux.HandleFunc("POST /api/users/verify-email", cfg.handlerVerifyEmail)
+	mux.HandleFunc("GET /api/users/{userID}", cfg.handlerGetUserProfile)
+	mux.Handle("POST /api/users/{userID}/follow", cfg.middlewareAuth(auth.ScopeUsersWrite, http.HandlerFunc(cfg.handlerFollowUser)))
+	mux.Handle("DELETE /api/users/{userID}/follow", cfg.middlewareAuth(auth.ScopeUsersWrite, http.HandlerFunc(cfg.handlerUnfollowUser)))
+	mux.Handle("POST /api/users/{userID}/reports", cfg.middlewareAuth(auth.ScopeUsersWrite, http.HandlerFunc(cfg.handlerReportUser)))
+	mux.HandleFunc("GET /api/users/{userID}/followers", cfg.handlerListFollowers)
+	mux.HandleFunc("GET /api/users/{userID}/following", cfg.handlerListFollowing)
+	mux.Handle("GET /api/timeline", cfg.middlewareAuth(auth.ScopeChirpsRead, http.HandlerFunc(cfg.handlerTimeline)))
+	mux.HandleFunc("GET /api/hashtags/trending", cfg.handlerTrendingHashtags)
+	mux.Handle("GET /api/hashtags/{tag}/chirps", cfg.middlewareOptionalAuth(auth.ScopeChirpsRead, http.HandlerFunc(cfg.handlerListHashtagChirps)))
+	mux.Handle("GET /api/mentions", cfg.middlewareAuth(auth.ScopeChirpsRead, http.HandlerFunc(cfg.handlerListMentions)))
 	mux.HandleFunc("POST /api/polka/webhooks", cfg.handlerPolkaWebhooks)
-	mux.HandleFunc("GET /api/chirps/{chirpID}", cfg.handlerGetChirp)
-	mux.HandleFunc("DELETE /api/chirps/{chirpID}", cfg.handlerDeleteChirp)
+	mux.Handle("POST /api/moderation/users/{userID}/suspend", cfg.middlewareAuth(auth.ScopeAccount, cfg.middlewareRequireRole(auth.RoleModerator, http.HandlerFunc(cfg.handlerSuspendUser))))
+	mux.Handle("POST /api/moderation/users/{userID}/ban", cfg.middlewareAuth(auth.ScopeAccount, cfg.middlewareRequireRole(auth.RoleModerator, http.HandlerFunc(cfg.handlerBanUser))))
+	mux.Handle("POST /api/moderation/users/{userID}/reinstate", cfg.middlewareAuth(auth.ScopeAccount, cfg.middlewareRequireRole(auth.RoleModerator, http.HandlerFunc(cfg.handlerReinstateUser))))
+	mux.Handle("POST /api/moderation/chirps/{chirpID}/remove", cfg.middlewareAuth(auth.ScopeAccount, cfg.middlewareRequireRole(auth.RoleModerator, http.HandlerFunc(cfg.handlerRemoveChirp))))
+	mux.Handle("GET /api/moderation/actions", cfg.middlewareAuth(auth.ScopeAccount, cfg.middlewareRequireRole(auth.RoleModerator, http.HandlerFunc(cfg.handlerListModerationActions))))
+	mux.Handle("GET /api/moderation/reports", cfg.middlewareAuth(auth.ScopeAccount, cfg.middlewareRequireRole(auth.RoleModerator, http.HandlerFunc(cfg.handlerListReports))))
+	mux.Handle("POST /api/moderation/reports/{reportID}/claim", cfg.middlewareAuth(auth.ScopeAccount, cfg.middlewareRequireRole(auth.RoleModerator, http.HandlerFunc(cfg.handlerClaimReport))))
+	mux.Handle("POST /api/moderation/reports/{reportID}/resolve", cfg.middlewareAuth(auth.ScopeAccount, cfg.middlewareRequireRole(auth.RoleModerator, http.HandlerFunc(cfg.handlerResolveReport))))
+	mux.Handle("POST /api/moderation/reports/{reportID}/dismiss", cfg.middlewareAuth(auth.ScopeAccount, cfg.middlewareRequireRole(auth.RoleModerator, http.HandlerFunc(cfg.handlerDismissReport))))
+	mux.Handle("GET /api/chirps/search", cfg.middlewareOptionalAuth(auth.ScopeChirpsRead, http.HandlerFunc(cfg.handlerSearchChirps)))
+	mux.Handle("GET /api/chirps/{chirpID}", cfg.middlewareOptionalAuth(auth.ScopeChirpsRead, http.HandlerFunc(cfg.handlerGetChirp)))
+	mux.Handle("PUT /api/chirps/{chirpID}", cfg.middlewareAuth(auth.ScopeChirpsWrite, http.HandlerFunc(cfg.handlerUpdateChirp)))
+	mux.Handle("DELETE /api/chirps/{chirpID}", cfg.middlewareAuth(auth.ScopeChirpsWrite, http.HandlerFunc(cfg.handlerDeleteChirp)))
+	mux.HandleFunc("GET /api/chirps/{chirpID}/revisions", cfg.handlerListChirpRevisions)
+	mux.Handle("GET /api/chirps/{chirpID}/replies", cfg.middlewareOptionalAuth(auth.ScopeChirpsRead, http.HandlerFunc(cfg.handlerListChirpReplies)))
+	mux.Handle("GET /api/chirps/{chirpID}/thread", cfg.middlewareOptionalAuth(auth.ScopeChirpsRead, http.HandlerFunc(cfg.handlerGetChirpThread)))
+	mux.Handle("POST /api/chirps/{chirpID}/likes", cfg.middlewareAuth(auth.ScopeChirpsWrite, http.HandlerFunc(cfg.handlerLikeChirp)))
+	mux.Handle("DELETE /api/chirps/{chirpID}/likes", cfg.middlewareAuth(auth.ScopeChirpsWrite, http.HandlerFunc(cfg.handlerUnlikeChirp)))
+	mux.Handle("POST /api/chirps/{chirpID}/rechirps", cfg.middlewareAuth(auth.ScopeChirpsWrite, http.HandlerFunc(cfg.handlerRechirp)))
+	mux.Handle("DELETE /api/chirps/{chirpID}/rechirps", cfg.middlewareAuth(auth.ScopeChirpsWrite, http.HandlerFunc(cfg.handlerUndoRechirp)))
+	mux.Handle("POST /api/chirps/{chirpID}/reports", cfg.middlewareAuth(auth.ScopeChirpsWrite, http.HandlerFunc(cfg.handlerReportChirp)))
 
 	fileServer := http.FileServer(http.Dir(filePathRoot))
 	mux.Handle("/app/", http.StripPrefix("/app/", cfg.middlewareMetricsInc(fileServer)))
@@ -65,3 +173,42 @@ func main() {
 		log.Fatalf("Server failed to start: %v", err)
 	}
 }
+
+// loadTokenKeys builds the keyring access tokens are signed with.
+// JWT_SIGNING_KEY_FILE holds the current Ed25519 private key and the
+// optional JWT_VERIFICATION_KEYS_FILE the public keys of retired ones that
+// tokens are still accepted from. Without a key file, a key is derived from
+// BEARER_TOKEN so development setups keep working.
+func loadTokenKeys(issuer, bearerToken string) (*auth.Keyring, error) {
+	keyFile := os.Getenv("JWT_SIGNING_KEY_FILE")
+	if keyFile == "" {
+		if bearerToken == "" {
+			return nil, errors.New("set JWT_SIGNING_KEY_FILE or BEARER_TOKEN")
+		}
+		log.Printf("JWT_SIGNING_KEY_FILE is not set; deriving the JWT signing key from BEARER_TOKEN")
+		return auth.NewKeyring(issuer, auth.KeyFromSecret(bearerToken))
+	}
+
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	signingKey, err := auth.ParseSigningKeyPEM(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var verificationKeys []ed25519.PublicKey
+	if verificationFile := os.Getenv("JWT_VERIFICATION_KEYS_FILE"); verificationFile != "" {
+		data, err := os.ReadFile(verificationFile)
+		if err != nil {
+			return nil, err
+		}
+		verificationKeys, err = auth.ParseVerificationKeysPEM(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return auth.NewKeyring(issuer, signingKey, verificationKeys...)
+}
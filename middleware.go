@@ -1,6 +1,16 @@
 package main
 
-import "net/http"
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/glebson1988/chirpy/internal/auth"
+	"github.com/google/uuid"
+)
 
 func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -8,3 +18,212 @@ func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+var (
+	errUnauthenticated   = errors.New("unauthenticated")
+	errInsufficientScope = errors.New("insufficient scope")
+)
+
+// principal is the caller identified by a request's Bearer token, which is
+// either an access token from logging in or a personal access token. Access
+// tokens act with the user's current role; personal access tokens act as
+// plain users.
+type principal struct {
+	UserID uuid.UUID
+	Role   string
+	Scopes []string
+	// PersonalAccessToken is set for personal access tokens, whose owner's
+	// standing is already checked when the token is looked up.
+	PersonalAccessToken bool
+}
+
+// accountSuspendedError rejects a caller whose account was suspended or
+// banned after their access token was issued.
+type accountSuspendedError struct {
+	message string
+}
+
+func (e accountSuspendedError) Error() string {
+	return e.message
+}
+
+type principalContextKey struct{}
+
+func contextWithPrincipal(ctx context.Context, p principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, p)
+}
+
+// principalFromContext returns the caller stored by middlewareAuth or
+// middlewareOptionalAuth, if there is one.
+func principalFromContext(ctx context.Context) (principal, bool) {
+	p, ok := ctx.Value(principalContextKey{}).(principal)
+	return p, ok
+}
+
+// middlewareAuth only lets requests through whose Bearer token is valid
+// and grants scope, and whose user isn't suspended or banned, and makes the
+// caller available to next through principalFromContext.
+func (cfg *apiConfig) middlewareAuth(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := cfg.authenticate(r)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		if !auth.HasScope(p.Scopes, scope) {
+			respondWithAuthError(w, errInsufficientScope)
+			return
+		}
+		p, err = cfg.checkStanding(r.Context(), p)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(contextWithPrincipal(r.Context(), p)))
+	})
+}
+
+// middlewareOptionalAuth is for endpoints that work without a token but
+// personalize their output when one is supplied. Requests without an
+// Authorization header, whose token lacks scope, or whose user is suspended
+// or banned are served anonymously; a token that is invalid or expired is
+// still rejected, so clients find out they need to refresh it.
+func (cfg *apiConfig) middlewareOptionalAuth(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		p, err := cfg.authenticate(r)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		if !auth.HasScope(p.Scopes, scope) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		p, err = cfg.checkStanding(r.Context(), p)
+		if err != nil {
+			var suspended accountSuspendedError
+			if errors.As(err, &suspended) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			respondWithAuthError(w, err)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(contextWithPrincipal(r.Context(), p)))
+	})
+}
+
+// middlewareRequireRole only lets callers with at least role through. It
+// goes inside middlewareAuth, which identifies the caller and looks up
+// their current role, so a demotion takes effect on the next request.
+func (cfg *apiConfig) middlewareRequireRole(role string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := principalFromContext(r.Context())
+		if !ok {
+			respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		if !auth.HasRole(p.Role, role) {
+			respondWithError(w, http.StatusForbidden, "Forbidden")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authenticate identifies the caller from the request's Bearer token.
+func (cfg *apiConfig) authenticate(r *http.Request) (principal, error) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return principal{}, errUnauthenticated
+	}
+
+	if auth.IsPersonalAccessToken(token) {
+		return cfg.lookupPersonalAccessToken(r.Context(), token)
+	}
+
+	claims, err := auth.ValidateJWT(token, cfg.tokenKeys)
+	if err != nil {
+		return principal{}, errUnauthenticated
+	}
+	return principal{UserID: claims.UserID, Role: claims.Role, Scopes: claims.Scopes}, nil
+}
+
+// lookupPersonalAccessToken returns the owner and scopes of a live personal
+// access token and records that it was used. Tokens of suspended or banned
+// users aren't found.
+func (cfg *apiConfig) lookupPersonalAccessToken(ctx context.Context, token string) (principal, error) {
+	pat, err := cfg.tokenStore.GetPersonalAccessToken(ctx, auth.HashToken(token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return principal{}, errUnauthenticated
+		}
+		return principal{}, err
+	}
+
+	if pat.RevokedAt.Valid || (pat.ExpiresAt.Valid && !pat.ExpiresAt.Time.After(time.Now().UTC())) {
+		return principal{}, errUnauthenticated
+	}
+
+	// Failing to record last use shouldn't fail the request.
+	if err := cfg.tokenStore.TouchPersonalAccessToken(ctx, pat.ID); err != nil {
+		log.Printf("Failed to record use of personal access token %s: %v", pat.ID, err)
+	}
+
+	return principal{UserID: pat.UserID, Role: auth.RoleUser, Scopes: pat.Scopes, PersonalAccessToken: true}, nil
+}
+
+// checkStanding rejects callers whose account was suspended or banned after
+// they logged in, and returns p with the user's current role in place of
+// the one in their token. Access tokens outlive the refresh tokens
+// moderation revokes and the role they were issued with, so they are
+// checked against the user on every request.
+func (cfg *apiConfig) checkStanding(ctx context.Context, p principal) (principal, error) {
+	if p.PersonalAccessToken {
+		return p, nil
+	}
+
+	standing, err := cfg.tokenStore.GetUserStanding(ctx, p.UserID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return principal{}, errUnauthenticated
+		}
+		return principal{}, err
+	}
+
+	if msg := suspensionMessage(standing.BannedAt, standing.SuspendedUntil); msg != "" {
+		return principal{}, accountSuspendedError{message: msg}
+	}
+
+	p.Role = standing.Role
+	return p, nil
+}
+
+// respondWithAuthError reports an error from authenticate or checkStanding.
+func respondWithAuthError(w http.ResponseWriter, err error) {
+	var suspended accountSuspendedError
+	switch {
+	case errors.Is(err, errUnauthenticated):
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+	case errors.Is(err, errInsufficientScope):
+		respondWithError(w, http.StatusForbidden, "Token is missing a required scope")
+	case errors.As(err, &suspended):
+		respondWithError(w, http.StatusForbidden, suspended.message)
+	default:
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+	}
+}
+
+// userIDFromContext returns the caller authenticated by middlewareAuth.
+func userIDFromContext(ctx context.Context) (uuid.UUID, bool) {
+	p, ok := principalFromContext(ctx)
+	return p.UserID, ok
+}
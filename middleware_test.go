@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebson1988/chirpy/internal/auth"
+	"github.com/glebson1988/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestMiddlewareAuth(t *testing.T) {
+	cfg := &apiConfig{tokenKeys: newTestKeyring(t), tokenStore: &stubDB{}}
+	userID := uuid.New()
+
+	token, err := auth.MakeJWT(userID, auth.RoleUser, []string{auth.ScopeChirpsRead}, cfg.tokenKeys, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT: %v", err)
+	}
+
+	var gotID uuid.UUID
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ok bool
+		if gotID, ok = userIDFromContext(r.Context()); !ok {
+			t.Fatal("no principal in context")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name          string
+		authorization string
+		scope         string
+		wantStatus    int
+	}{
+		{name: "valid", authorization: "Bearer " + token, scope: auth.ScopeChirpsRead, wantStatus: http.StatusNoContent},
+		{name: "missing scope", authorization: "Bearer " + token, scope: auth.ScopeChirpsWrite, wantStatus: http.StatusForbidden},
+		{name: "invalid token", authorization: "Bearer not-a-token", scope: auth.ScopeChirpsRead, wantStatus: http.StatusUnauthorized},
+		{name: "no token", scope: auth.ScopeChirpsRead, wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotID = uuid.Nil
+			req := httptest.NewRequest(http.MethodGet, "/api/timeline", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+
+			cfg.middlewareAuth(tt.scope, next).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusNoContent && gotID != userID {
+				t.Fatalf("principal = %v, want %v", gotID, userID)
+			}
+		})
+	}
+}
+
+func TestMiddlewareAuthChecksStanding(t *testing.T) {
+	now := time.Now().UTC()
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name       string
+		standing   database.GetUserStandingRow
+		lookup     error
+		wantStatus int
+	}{
+		{name: "in good standing", wantStatus: http.StatusNoContent},
+		{name: "banned", standing: database.GetUserStandingRow{BannedAt: sql.NullTime{Time: now, Valid: true}}, wantStatus: http.StatusForbidden},
+		{name: "suspended", standing: database.GetUserStandingRow{SuspendedUntil: sql.NullTime{Time: now.Add(time.Hour), Valid: true}}, wantStatus: http.StatusForbidden},
+		{name: "suspension over", standing: database.GetUserStandingRow{SuspendedUntil: sql.NullTime{Time: now.Add(-time.Hour), Valid: true}}, wantStatus: http.StatusNoContent},
+		{name: "deleted", lookup: sql.ErrNoRows, wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID := uuid.New()
+			db := &stubDB{
+				getUserStanding: func(ctx context.Context, id uuid.UUID) (database.GetUserStandingRow, error) {
+					if id != userID {
+						t.Fatalf("looked up %v, want %v", id, userID)
+					}
+					return tt.standing, tt.lookup
+				},
+			}
+			cfg := &apiConfig{tokenKeys: newTestKeyring(t), tokenStore: db}
+
+			// The access token predates the suspension or ban.
+			token, err := auth.MakeJWT(userID, auth.RoleUser, auth.SessionScopes, cfg.tokenKeys, time.Hour)
+			if err != nil {
+				t.Fatalf("MakeJWT: %v", err)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/api/chirps", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+
+			cfg.middlewareAuth(auth.ScopeChirpsWrite, next).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestMiddlewareOptionalAuth(t *testing.T) {
+	userID := uuid.New()
+	bannedID := uuid.New()
+	db := &stubDB{
+		getUserStanding: func(ctx context.Context, id uuid.UUID) (database.GetUserStandingRow, error) {
+			if id == bannedID {
+				return database.GetUserStandingRow{BannedAt: sql.NullTime{Time: time.Now(), Valid: true}}, nil
+			}
+			return database.GetUserStandingRow{}, nil
+		},
+	}
+	cfg := &apiConfig{tokenKeys: newTestKeyring(t), tokenStore: db}
+
+	readToken, err := auth.MakeJWT(userID, auth.RoleUser, []string{auth.ScopeChirpsRead}, cfg.tokenKeys, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT: %v", err)
+	}
+	writeToken, err := auth.MakeJWT(userID, auth.RoleUser, []string{auth.ScopeChirpsWrite}, cfg.tokenKeys, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT: %v", err)
+	}
+
+	bannedToken, err := auth.MakeJWT(bannedID, auth.RoleUser, []string{auth.ScopeChirpsRead}, cfg.tokenKeys, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT: %v", err)
+	}
+
+	var got uuid.NullUUID
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = viewerID(r)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantStatus    int
+		want          uuid.NullUUID
+	}{
+		{name: "anonymous", wantStatus: http.StatusOK},
+		{name: "valid", authorization: "Bearer " + readToken, wantStatus: http.StatusOK, want: uuid.NullUUID{UUID: userID, Valid: true}},
+		{name: "missing scope", authorization: "Bearer " + writeToken, wantStatus: http.StatusOK},
+		{name: "banned", authorization: "Bearer " + bannedToken, wantStatus: http.StatusOK},
+		{name: "invalid token", authorization: "Bearer not-a-token", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = uuid.NullUUID{}
+			req := httptest.NewRequest(http.MethodGet, "/api/chirps", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+
+			cfg.middlewareOptionalAuth(auth.ScopeChirpsRead, next).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got != tt.want {
+				t.Fatalf("viewerID() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMiddlewareRequireRole(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	// The role in the users table wins over the one the token was issued
+	// with, so promotions and demotions apply straight away.
+	for _, tt := range []struct {
+		tokenRole  string
+		role       string
+		wantStatus int
+	}{
+		{tokenRole: auth.RoleAdmin, role: auth.RoleAdmin, wantStatus: http.StatusNoContent},
+		{tokenRole: auth.RoleModerator, role: auth.RoleModerator, wantStatus: http.StatusNoContent},
+		{tokenRole: auth.RoleUser, role: auth.RoleUser, wantStatus: http.StatusForbidden},
+		{tokenRole: auth.RoleAdmin, role: auth.RoleUser, wantStatus: http.StatusForbidden},
+		{tokenRole: auth.RoleUser, role: auth.RoleModerator, wantStatus: http.StatusNoContent},
+	} {
+		db := &stubDB{
+			getUserStanding: func(ctx context.Context, id uuid.UUID) (database.GetUserStandingRow, error) {
+				return database.GetUserStandingRow{Role: tt.role}, nil
+			},
+		}
+		cfg := &apiConfig{tokenKeys: newTestKeyring(t), tokenStore: db}
+		handler := cfg.middlewareAuth(auth.ScopeAccount, cfg.middlewareRequireRole(auth.RoleModerator, next))
+
+		token, err := auth.MakeJWT(uuid.New(), tt.tokenRole, auth.SessionScopes, cfg.tokenKeys, time.Hour)
+		if err != nil {
+			t.Fatalf("MakeJWT: %v", err)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/admin/metrics", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != tt.wantStatus {
+			t.Fatalf("token role %q, role %q: status = %d, want %d", tt.tokenRole, tt.role, rec.Code, tt.wantStatus)
+		}
+	}
+}
+
+func TestAuthenticatePersonalAccessToken(t *testing.T) {
+	token, err := auth.MakePersonalAccessToken()
+	if err != nil {
+		t.Fatalf("MakePersonalAccessToken: %v", err)
+	}
+	userID := uuid.New()
+	past := sql.NullTime{Time: time.Now().Add(-time.Minute), Valid: true}
+
+	tests := []struct {
+		name    string
+		pat     database.PersonalAccessToken
+		lookup  error
+		scope   string
+		wantErr error
+	}{
+		{
+			name:  "valid",
+			pat:   database.PersonalAccessToken{UserID: userID, Scopes: []string{auth.ScopeChirpsWrite}},
+			scope: auth.ScopeChirpsWrite,
+		},
+		{
+			name:    "missing scope",
+			pat:     database.PersonalAccessToken{UserID: userID, Scopes: []string{auth.ScopeChirpsRead}},
+			scope:   auth.ScopeChirpsWrite,
+			wantErr: errInsufficientScope,
+		},
+		{
+			name:    "revoked",
+			pat:     database.PersonalAccessToken{UserID: userID, Scopes: []string{auth.ScopeChirpsWrite}, RevokedAt: past},
+			scope:   auth.ScopeChirpsWrite,
+			wantErr: errUnauthenticated,
+		},
+		{
+			name:    "expired",
+			pat:     database.PersonalAccessToken{UserID: userID, Scopes: []string{auth.ScopeChirpsWrite}, ExpiresAt: past},
+			scope:   auth.ScopeChirpsWrite,
+			wantErr: errUnauthenticated,
+		},
+		{
+			name:    "unknown",
+			lookup:  sql.ErrNoRows,
+			scope:   auth.ScopeChirpsWrite,
+			wantErr: errUnauthenticated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			touched := false
+			db := &stubDB{
+				getPersonalAccessToken: func(ctx context.Context, tokenHash string) (database.PersonalAccessToken, error) {
+					if tokenHash != auth.HashToken(token) {
+						t.Fatalf("looked up %q, want digest of token", tokenHash)
+					}
+					return tt.pat, tt.lookup
+				},
+				touchPersonalAccessToken: func(ctx context.Context, id uuid.UUID) error {
+					touched = true
+					return nil
+				},
+			}
+			cfg := &apiConfig{tokenKeys: newTestKeyring(t), tokenStore: db}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/chirps", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+
+			p, err := cfg.authenticate(req)
+			if err == nil && !auth.HasScope(p.Scopes, tt.scope) {
+				err = errInsufficientScope
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("authenticate() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && p.UserID != userID {
+				t.Fatalf("authenticate() = %v, want %v", p.UserID, userID)
+			}
+			// Only live tokens count as used, whether or not they had the scope.
+			if wantTouched := tt.wantErr == nil || tt.wantErr == errInsufficientScope; touched != wantTouched {
+				t.Fatalf("touched = %v, want %v", touched, wantTouched)
+			}
+		})
+	}
+}
+
+func TestHandlerPatchUserPasswordNeedsAccountScope(t *testing.T) {
+	cfg := &apiConfig{tokenKeys: newTestKeyring(t), tokenStore: &stubDB{}}
+
+	token, err := auth.MakeJWT(uuid.New(), auth.RoleUser, auth.GrantableScopes, cfg.tokenKeys, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPatch, "/api/users/me", strings.NewReader(`{"password": "new", "current_password": "old"}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+
+	cfg.middlewareAuth(auth.ScopeUsersWrite, http.HandlerFunc(cfg.handlerPatchUser)).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
+
+func TestHandlerCreatePersonalAccessTokenRejectsAccountScope(t *testing.T) {
+	cfg := &apiConfig{tokenKeys: newTestKeyring(t), tokenStore: &stubDB{}}
+
+	token, err := auth.MakeJWT(uuid.New(), auth.RoleUser, auth.SessionScopes, cfg.tokenKeys, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/tokens", strings.NewReader(`{"name": "ci", "scopes": ["chirps:write", "account"]}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+
+	cfg.middlewareAuth(auth.ScopeAccount, http.HandlerFunc(cfg.handlerCreatePersonalAccessToken)).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+// requestAs returns r as if middlewareAuth had let it through for p.
+func requestAs(r *http.Request, p principal) *http.Request {
+	return r.WithContext(contextWithPrincipal(r.Context(), p))
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/glebson1988/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// pageCursor marks a position in a (created_at, id) ordered list. Clients
+// only ever see it base64-encoded, so the fields can change without notice.
+type pageCursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        uuid.UUID `json:"id"`
+	Backward  bool      `json:"b,omitempty"`
+}
+
+func encodeCursor(cursor pageCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(value string) (pageCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return pageCursor{}, errors.New("invalid cursor")
+	}
+
+	var cursor pageCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return pageCursor{}, errors.New("invalid cursor")
+	}
+	if cursor.ID == uuid.Nil || cursor.CreatedAt.IsZero() {
+		return pageCursor{}, errors.New("invalid cursor")
+	}
+
+	return cursor, nil
+}
+
+func parsePageLimit(value string) (int, error) {
+	if value == "" {
+		return defaultPageLimit, nil
+	}
+
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 {
+		return 0, errors.New("invalid limit")
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+
+	return limit, nil
+}
+
+// parsePageParams reads the limit and cursor query parameters. The returned
+// cursor is nil when the client is asking for the first page.
+func parsePageParams(r *http.Request) (int, *pageCursor, error) {
+	limit, err := parsePageLimit(r.URL.Query().Get("limit"))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	cursorParam := r.URL.Query().Get("cursor")
+	if cursorParam == "" {
+		return limit, nil, nil
+	}
+
+	cursor, err := decodeCursor(cursorParam)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return limit, &cursor, nil
+}
+
+func (c *pageCursor) createdAt() sql.NullTime {
+	if c == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: c.CreatedAt, Valid: true}
+}
+
+func (c *pageCursor) id() uuid.NullUUID {
+	if c == nil {
+		return uuid.NullUUID{}
+	}
+	return uuid.NullUUID{UUID: c.ID, Valid: true}
+}
+
+type chirpPage struct {
+	chirps []database.Chirp
+	next   *pageCursor
+	prev   *pageCursor
+}
+
+// paginateChirps turns rows fetched with a limit of limit+1 in the query's
+// direction into a page in display order, along with the cursors needed to
+// fetch the neighbouring pages.
+func paginateChirps(rows []database.Chirp, limit int, cursor *pageCursor) chirpPage {
+	hasMore := len(rows) > limit
+	if hasMore {
+		rows = rows[:limit]
+	}
+
+	backward := cursor != nil && cursor.Backward
+	if backward {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+
+	page := chirpPage{chirps: rows}
+	if len(rows) == 0 {
+		return page
+	}
+
+	first := rows[0]
+	last := rows[len(rows)-1]
+	if backward || hasMore {
+		page.next = &pageCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+	if (backward && hasMore) || (!backward && cursor != nil) {
+		page.prev = &pageCursor{CreatedAt: first.CreatedAt, ID: first.ID, Backward: true}
+	}
+
+	return page
+}
+
+// setPaginationLinks advertises the neighbouring pages using RFC 8288 Link
+// headers so the response body can stay a plain JSON array.
+func setPaginationLinks(w http.ResponseWriter, r *http.Request, next, prev *pageCursor) {
+	link := func(cursor *pageCursor, rel string) {
+		query := r.URL.Query()
+		query.Set("cursor", encodeCursor(*cursor))
+		w.Header().Add("Link", fmt.Sprintf(`<%s?%s>; rel="%s"`, r.URL.Path, query.Encode(), rel))
+	}
+
+	if next != nil {
+		link(next, "next")
+	}
+	if prev != nil {
+		link(prev, "prev")
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebson1988/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func makeChirps(n int) []database.Chirp {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	chirps := make([]database.Chirp, 0, n)
+	for i := 0; i < n; i++ {
+		chirps = append(chirps, database.Chirp{
+			ID:        uuid.New(),
+			CreatedAt: start.Add(time.Duration(i) * time.Minute),
+		})
+	}
+	return chirps
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	cursor := pageCursor{
+		CreatedAt: time.Date(2024, 1, 1, 12, 30, 0, 123456000, time.UTC),
+		ID:        uuid.New(),
+		Backward:  true,
+	}
+
+	got, err := decodeCursor(encodeCursor(cursor))
+	if err != nil {
+		t.Fatalf("decodeCursor() error = %v", err)
+	}
+	if !got.CreatedAt.Equal(cursor.CreatedAt) || got.ID != cursor.ID || got.Backward != cursor.Backward {
+		t.Fatalf("decodeCursor() got %+v, want %+v", got, cursor)
+	}
+}
+
+func TestDecodeCursorRejectsGarbage(t *testing.T) {
+	for _, value := range []string{"not base64!", "bm90IGpzb24", "e30"} {
+		if _, err := decodeCursor(value); err == nil {
+			t.Fatalf("decodeCursor(%q) expected error", value)
+		}
+	}
+}
+
+func TestParsePageLimit(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{value: "", want: defaultPageLimit},
+		{value: "5", want: 5},
+		{value: "1000", want: maxPageLimit},
+		{value: "0", wantErr: true},
+		{value: "abc", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parsePageLimit(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("parsePageLimit(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Fatalf("parsePageLimit(%q) got %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestPaginateChirpsFirstPage(t *testing.T) {
+	rows := makeChirps(4)
+
+	page := paginateChirps(rows, 3, nil)
+
+	if len(page.chirps) != 3 {
+		t.Fatalf("paginateChirps() got %d chirps, want 3", len(page.chirps))
+	}
+	if page.next == nil || page.next.ID != rows[2].ID || page.next.Backward {
+		t.Fatalf("paginateChirps() next = %+v, want forward cursor at %v", page.next, rows[2].ID)
+	}
+	if page.prev != nil {
+		t.Fatalf("paginateChirps() prev = %+v, want nil on first page", page.prev)
+	}
+}
+
+func TestPaginateChirpsLastPage(t *testing.T) {
+	rows := makeChirps(2)
+	cursor := &pageCursor{CreatedAt: rows[0].CreatedAt.Add(-time.Minute), ID: uuid.New()}
+
+	page := paginateChirps(rows, 3, cursor)
+
+	if page.next != nil {
+		t.Fatalf("paginateChirps() next = %+v, want nil on last page", page.next)
+	}
+	if page.prev == nil || page.prev.ID != rows[0].ID || !page.prev.Backward {
+		t.Fatalf("paginateChirps() prev = %+v, want backward cursor at %v", page.prev, rows[0].ID)
+	}
+}
+
+func TestPaginateChirpsBackwardRestoresOrder(t *testing.T) {
+	// Rows arrive newest-first when walking backwards through an ascending list.
+	rows := makeChirps(4)
+	reversed := []database.Chirp{rows[3], rows[2], rows[1], rows[0]}
+	cursor := &pageCursor{CreatedAt: rows[3].CreatedAt.Add(time.Minute), ID: uuid.New(), Backward: true}
+
+	page := paginateChirps(reversed, 3, cursor)
+
+	want := []uuid.UUID{rows[1].ID, rows[2].ID, rows[3].ID}
+	for i, chirp := range page.chirps {
+		if chirp.ID != want[i] {
+			t.Fatalf("paginateChirps() chirp %d = %v, want %v", i, chirp.ID, want[i])
+		}
+	}
+	if page.next == nil || page.next.ID != rows[3].ID {
+		t.Fatalf("paginateChirps() next = %+v, want cursor at %v", page.next, rows[3].ID)
+	}
+	if page.prev == nil || page.prev.ID != rows[1].ID || !page.prev.Backward {
+		t.Fatalf("paginateChirps() prev = %+v, want backward cursor at %v", page.prev, rows[1].ID)
+	}
+}
+
+func TestSetPaginationLinks(t *testing.T) {
+	rows := makeChirps(1)
+	page := chirpPage{
+		chirps: rows,
+		next:   &pageCursor{CreatedAt: rows[0].CreatedAt, ID: rows[0].ID},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/chirps?sort=desc&limit=1", nil)
+	rec := httptest.NewRecorder()
+
+	setPaginationLinks(rec, req, page.next, page.prev)
+
+	links := rec.Header().Values("Link")
+	if len(links) != 1 {
+		t.Fatalf("setPaginationLinks() got %d links, want 1", len(links))
+	}
+	if !strings.HasPrefix(links[0], "</api/chirps?") || !strings.HasSuffix(links[0], `>; rel="next"`) {
+		t.Fatalf("setPaginationLinks() got %q", links[0])
+	}
+	if !strings.Contains(links[0], "sort=desc") || !strings.Contains(links[0], "limit=1") {
+		t.Fatalf("setPaginationLinks() dropped query parameters: %q", links[0])
+	}
+}
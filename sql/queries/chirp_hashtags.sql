@@ -0,0 +1,16 @@
+-- name: CreateChirpHashtags :exec
+INSERT INTO chirp_hashtags (chirp_id, tag, created_at)
+SELECT sqlc.arg('chirp_id')::uuid, unnest(sqlc.arg('tags')::text[]), sqlc.arg('created_at')::timestamp
+ON CONFLICT (chirp_id, tag) DO NOTHING;
+
+-- name: DeleteChirpHashtags :exec
+DELETE FROM chirp_hashtags
+WHERE chirp_id = $1;
+
+-- name: ListTrendingHashtags :many
+SELECT tag, COUNT(*) AS uses
+FROM chirp_hashtags
+WHERE created_at >= sqlc.arg('since')::timestamp
+GROUP BY tag
+ORDER BY uses DESC, tag ASC
+LIMIT sqlc.arg('row_limit');
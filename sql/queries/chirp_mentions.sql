@@ -0,0 +1,16 @@
+-- name: CreateChirpMentions :exec
+INSERT INTO chirp_mentions (chirp_id, user_id, start_offset, length)
+SELECT
+  sqlc.arg('chirp_id')::uuid,
+  unnest(sqlc.arg('user_ids')::uuid[]),
+  unnest(sqlc.arg('start_offsets')::integer[]),
+  unnest(sqlc.arg('lengths')::integer[]);
+
+-- name: DeleteChirpMentions :exec
+DELETE FROM chirp_mentions
+WHERE chirp_id = $1;
+
+-- name: GetChirpMentions :many
+SELECT * FROM chirp_mentions
+WHERE chirp_id = ANY(sqlc.arg('chirp_ids')::uuid[])
+ORDER BY chirp_id, start_offset;
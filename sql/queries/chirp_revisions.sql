@@ -0,0 +1,17 @@
+-- name: CreateChirpRevision :exec
+INSERT INTO chirp_revisions (id, created_at, chirp_id, body)
+VALUES (
+  gen_random_uuid(),
+  $1,
+  $2,
+  $3
+);
+
+-- name: ListChirpRevisions :many
+SELECT * FROM chirp_revisions
+WHERE chirp_id = $1
+ORDER BY created_at ASC, id ASC;
+
+-- name: DeleteChirpRevisions :exec
+DELETE FROM chirp_revisions
+WHERE chirp_id = $1;
@@ -1,29 +1,199 @@
 -- name: CreateChirp :one
 INSERT INTO chirps (
-  id, created_at, updated_at, body, user_id
+  id, created_at, updated_at, body, user_id, parent_id, quote_of_id
 )
 VALUES (
   gen_random_uuid(),
   NOW(),
   NOW(),
   $1,
+  $2,
+  $3,
+  $4
+)
+RETURNING *;
+
+-- name: CreateRechirp :one
+INSERT INTO chirps (
+  id, created_at, updated_at, body, user_id, rechirp_of_id
+)
+VALUES (
+  gen_random_uuid(),
+  NOW(),
+  NOW(),
+  '',
+  $1,
   $2
 )
+ON CONFLICT (user_id, rechirp_of_id) WHERE rechirp_of_id IS NOT NULL DO NOTHING
 RETURNING *;
 
--- name: GetChirps :many
+-- name: DeleteRechirp :execrows
+DELETE FROM chirps
+WHERE user_id = $1 AND rechirp_of_id = $2;
+
+-- name: DeleteRechirpsOf :exec
+DELETE FROM chirps
+WHERE rechirp_of_id = $1;
+
+-- name: ListChirpsAfter :many
+SELECT * FROM chirps
+WHERE deleted_at IS NULL
+  AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+  AND (sqlc.narg('parent_id')::uuid IS NULL OR parent_id = sqlc.narg('parent_id')::uuid)
+  AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) > (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+  )
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('row_limit');
+
+-- name: ListChirpsBefore :many
+SELECT * FROM chirps
+WHERE deleted_at IS NULL
+  AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+  AND (sqlc.narg('parent_id')::uuid IS NULL OR parent_id = sqlc.narg('parent_id')::uuid)
+  AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+  )
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('row_limit');
+
+-- name: ListTimelineAfter :many
+SELECT * FROM chirps
+WHERE deleted_at IS NULL
+  AND (
+    user_id = sqlc.arg('user_id')
+    OR user_id IN (SELECT followee_id FROM follows WHERE follower_id = sqlc.arg('user_id'))
+  )
+  AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) > (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+  )
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('row_limit');
+
+-- name: ListTimelineBefore :many
 SELECT * FROM chirps
-ORDER BY created_at ASC;
+WHERE deleted_at IS NULL
+  AND (
+    user_id = sqlc.arg('user_id')
+    OR user_id IN (SELECT followee_id FROM follows WHERE follower_id = sqlc.arg('user_id'))
+  )
+  AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+  )
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('row_limit');
 
--- name: GetChirpsByAuthor :many
+-- name: ListHashtagChirpsAfter :many
 SELECT * FROM chirps
-WHERE user_id = $1
-ORDER BY created_at ASC;
+WHERE deleted_at IS NULL
+  AND id IN (SELECT chirp_id FROM chirp_hashtags WHERE tag = sqlc.arg('tag'))
+  AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) > (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+  )
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('row_limit');
+
+-- name: ListHashtagChirpsBefore :many
+SELECT * FROM chirps
+WHERE deleted_at IS NULL
+  AND id IN (SELECT chirp_id FROM chirp_hashtags WHERE tag = sqlc.arg('tag'))
+  AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+  )
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('row_limit');
+
+-- name: ListMentionChirpsAfter :many
+SELECT * FROM chirps
+WHERE deleted_at IS NULL
+  AND id IN (SELECT chirp_id FROM chirp_mentions WHERE chirp_mentions.user_id = sqlc.arg('user_id'))
+  AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) > (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+  )
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('row_limit');
+
+-- name: ListMentionChirpsBefore :many
+SELECT * FROM chirps
+WHERE deleted_at IS NULL
+  AND id IN (SELECT chirp_id FROM chirp_mentions WHERE chirp_mentions.user_id = sqlc.arg('user_id'))
+  AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+  )
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('row_limit');
 
 -- name: GetChirpById :one
 SELECT * FROM chirps
 WHERE id = $1;
 
+-- name: GetChirpsByIds :many
+SELECT * FROM chirps
+WHERE id = ANY(sqlc.arg('ids')::uuid[]);
+
+-- name: GetChirpByIdForUpdate :one
+SELECT * FROM chirps
+WHERE id = $1
+FOR UPDATE;
+
+-- name: UpdateChirpBody :one
+UPDATE chirps
+SET body = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
 -- name: DeleteChirp :exec
 DELETE FROM chirps
 WHERE id = $1;
+
+-- name: ChirpIsReferenced :one
+SELECT EXISTS (
+  SELECT 1 FROM chirps
+  WHERE parent_id = sqlc.arg('id')::uuid OR quote_of_id = sqlc.arg('id')::uuid
+)::boolean AS is_referenced;
+
+-- name: TombstoneChirp :exec
+UPDATE chirps
+SET body = '', deleted_at = NOW(), updated_at = NOW()
+WHERE id = $1;
+
+-- name: GetChirpThread :many
+WITH RECURSIVE ancestors AS (
+  SELECT chirps.id, chirps.parent_id FROM chirps
+  WHERE chirps.id = $1
+  UNION ALL
+  SELECT chirps.id, chirps.parent_id FROM chirps
+  JOIN ancestors ON chirps.id = ancestors.parent_id
+), thread AS (
+  SELECT chirps.* FROM chirps
+  WHERE chirps.id = (SELECT ancestors.id FROM ancestors WHERE ancestors.parent_id IS NULL)
+  UNION ALL
+  SELECT chirps.* FROM chirps
+  JOIN thread ON chirps.parent_id = thread.id
+)
+SELECT * FROM thread
+ORDER BY created_at ASC, id ASC;
+
+-- name: SearchChirps :many
+SELECT * FROM chirps
+WHERE search_vector @@ to_tsquery('english', sqlc.arg('query'))
+  AND deleted_at IS NULL
+  AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+ORDER BY ts_rank_cd(search_vector, to_tsquery('english', sqlc.arg('query'))) DESC, created_at DESC, id DESC
+LIMIT sqlc.arg('row_limit')
+OFFSET sqlc.arg('row_offset');
+
+-- name: ListUserChirps :many
+SELECT *
+FROM chirps
+WHERE user_id = $1 AND deleted_at IS NULL
+ORDER BY created_at ASC, id ASC;
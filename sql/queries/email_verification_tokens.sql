@@ -0,0 +1,9 @@
+-- name: CreateEmailVerificationToken :exec
+INSERT INTO email_verification_tokens (id, user_id, email, created_at, expires_at)
+VALUES ($1, $2, $3, NOW(), $4);
+
+-- name: UseEmailVerificationToken :one
+UPDATE email_verification_tokens
+SET used_at = NOW()
+WHERE id = $1 AND user_id = $2 AND used_at IS NULL AND expires_at > NOW()
+RETURNING email;
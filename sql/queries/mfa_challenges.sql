@@ -0,0 +1,23 @@
+-- name: CreateMFAChallenge :exec
+INSERT INTO mfa_challenges (id, user_id, created_at, expires_at)
+VALUES ($1, $2, NOW(), $3);
+
+-- name: CountRecentMFAAttempts :one
+SELECT COALESCE(SUM(attempts), 0)::bigint AS attempts
+FROM mfa_challenges
+WHERE user_id = $1 AND used_at IS NULL AND created_at > $2;
+
+-- name: ClaimMFAChallengeAttempt :one
+UPDATE mfa_challenges
+SET attempts = attempts + 1
+WHERE id = sqlc.arg('id')
+  AND user_id = sqlc.arg('user_id')
+  AND used_at IS NULL
+  AND expires_at > NOW()
+  AND attempts < sqlc.arg('max_attempts')
+RETURNING attempts;
+
+-- name: UseMFAChallenge :execrows
+UPDATE mfa_challenges
+SET used_at = NOW()
+WHERE id = $1 AND used_at IS NULL AND expires_at > NOW();
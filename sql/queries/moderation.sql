@@ -0,0 +1,33 @@
+-- name: SuspendUser :exec
+UPDATE users
+SET suspended_until = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: BanUser :exec
+UPDATE users
+SET banned_at = NOW(), updated_at = NOW()
+WHERE id = $1;
+
+-- name: ReinstateUser :exec
+UPDATE users
+SET suspended_until = NULL, banned_at = NULL, updated_at = NOW()
+WHERE id = $1;
+
+-- name: CreateModerationAction :one
+INSERT INTO moderation_actions (id, moderator_id, action, target_user_id, target_chirp_id, reason, suspended_until, report_id, created_at)
+VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, $6, $7, NOW())
+RETURNING *;
+
+-- name: ListModerationActions :many
+SELECT * FROM moderation_actions
+WHERE (sqlc.narg('target_user_id')::uuid IS NULL OR target_user_id = sqlc.narg('target_user_id')::uuid)
+  AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+  )
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('row_limit');
+
+-- name: GetUserStanding :one
+SELECT role, banned_at, suspended_until FROM users
+WHERE id = $1;
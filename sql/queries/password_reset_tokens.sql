@@ -0,0 +1,20 @@
+-- name: CreatePasswordResetToken :execrows
+INSERT INTO password_reset_tokens (token_hash, user_id, created_at, expires_at)
+SELECT sqlc.arg('token_hash')::text, sqlc.arg('user_id')::uuid, NOW(), sqlc.arg('expires_at')::timestamp
+WHERE NOT EXISTS (
+  SELECT 1 FROM password_reset_tokens
+  WHERE user_id = sqlc.arg('user_id')
+    AND used_at IS NULL
+    AND created_at > sqlc.arg('since')
+);
+
+-- name: UsePasswordResetToken :one
+UPDATE password_reset_tokens
+SET used_at = NOW()
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+RETURNING user_id;
+
+-- name: ExpirePasswordResetTokens :exec
+UPDATE password_reset_tokens
+SET used_at = NOW()
+WHERE user_id = $1 AND used_at IS NULL;
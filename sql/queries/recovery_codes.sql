@@ -0,0 +1,13 @@
+-- name: CreateRecoveryCodes :exec
+INSERT INTO recovery_codes (id, user_id, code_hash, created_at)
+SELECT gen_random_uuid(), sqlc.arg('user_id'), code_hash, NOW()
+FROM unnest(sqlc.arg('code_hashes')::text[]) AS code_hash;
+
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM recovery_codes
+WHERE user_id = $1;
+
+-- name: UseRecoveryCode :execrows
+UPDATE recovery_codes
+SET used_at = NOW()
+WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL;
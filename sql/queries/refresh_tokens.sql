@@ -1,17 +1,33 @@
 -- name: CreateRefreshToken :exec
 INSERT INTO refresh_tokens (
-  token, created_at, updated_at, expires_at, revoked_at, user_id
+  id, token_hash, created_at, updated_at, expires_at, revoked_at, user_id, family_id
 )
 VALUES (
-  $1, NOW(), NOW(), $2, NULL, $3
+  $1, $2, NOW(), NOW(), $3, NULL, $4, $5
 );
 
 -- name: GetUserFromRefreshToken :one
-SELECT user_id, expires_at, revoked_at
+SELECT refresh_tokens.user_id, refresh_tokens.expires_at, refresh_tokens.revoked_at, refresh_tokens.family_id, refresh_tokens.token_hash, users.role, users.suspended_until, users.banned_at
 FROM refresh_tokens
-WHERE token = $1;
+JOIN users ON users.id = refresh_tokens.user_id
+WHERE refresh_tokens.id = $1;
 
 -- name: RevokeRefreshToken :exec
 UPDATE refresh_tokens
 SET revoked_at = NOW(), updated_at = NOW()
-WHERE token = $1;
+WHERE id = $1;
+
+-- name: RevokeActiveRefreshToken :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND revoked_at IS NULL;
+
+-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE family_id = $1 AND revoked_at IS NULL;
+
+-- name: RevokeUserRefreshTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
@@ -0,0 +1,31 @@
+-- name: CreateReport :one
+INSERT INTO reports (id, reporter_id, chirp_id, user_id, category, details, created_at, updated_at)
+VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, NOW(), NOW())
+RETURNING *;
+
+-- name: GetReport :one
+SELECT * FROM reports
+WHERE id = $1;
+
+-- name: ListReports :many
+SELECT * FROM reports
+WHERE status = sqlc.arg('status')
+  AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) > (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+  )
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('row_limit');
+
+-- name: ClaimReport :one
+UPDATE reports
+SET status = 'claimed', assignee_id = $2, claimed_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND status = 'open'
+RETURNING *;
+
+-- name: CloseReport :one
+UPDATE reports
+SET status = sqlc.arg('status'), assignee_id = sqlc.arg('assignee_id'), resolution = sqlc.arg('resolution'), closed_at = NOW(), updated_at = NOW()
+WHERE id = sqlc.arg('id')
+  AND (status = 'open' OR (status = 'claimed' AND assignee_id = sqlc.arg('assignee_id')))
+RETURNING *;
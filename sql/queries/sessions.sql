@@ -0,0 +1,37 @@
+-- name: CreateSession :exec
+INSERT INTO sessions (id, user_id, created_at, user_agent, ip_address)
+VALUES ($1, $2, NOW(), $3, $4);
+
+-- name: ListUserSessions :many
+SELECT
+    sessions.id,
+    sessions.created_at,
+    sessions.user_agent,
+    sessions.ip_address,
+    MAX(refresh_tokens.created_at)::timestamp AS last_used_at
+FROM sessions
+JOIN refresh_tokens ON refresh_tokens.family_id = sessions.id
+WHERE sessions.user_id = $1
+GROUP BY sessions.id
+HAVING bool_or(refresh_tokens.revoked_at IS NULL AND refresh_tokens.expires_at > NOW())
+ORDER BY last_used_at DESC;
+
+-- name: ExportUserSessions :many
+SELECT
+    sessions.id,
+    sessions.created_at,
+    sessions.user_agent,
+    sessions.ip_address,
+    MAX(refresh_tokens.created_at)::timestamp AS last_used_at,
+    MAX(refresh_tokens.expires_at)::timestamp AS expires_at,
+    bool_or(refresh_tokens.revoked_at IS NULL AND refresh_tokens.expires_at > NOW()) AS active
+FROM sessions
+JOIN refresh_tokens ON refresh_tokens.family_id = sessions.id
+WHERE sessions.user_id = $1
+GROUP BY sessions.id
+ORDER BY sessions.created_at ASC;
+
+-- name: RevokeUserSession :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE family_id = $1 AND user_id = $2 AND revoked_at IS NULL;
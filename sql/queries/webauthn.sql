@@ -0,0 +1,42 @@
+-- name: CreateWebAuthnChallenge :exec
+INSERT INTO webauthn_challenges (id, user_id, purpose, challenge, created_at, expires_at)
+VALUES ($1, $2, $3, $4, NOW(), $5);
+
+-- name: UseWebAuthnChallenge :one
+DELETE FROM webauthn_challenges
+WHERE id = $1
+  AND purpose = $2
+  AND user_id IS NOT DISTINCT FROM sqlc.narg('user_id')
+  AND expires_at > NOW()
+RETURNING challenge;
+
+-- name: DeleteExpiredWebAuthnChallenges :exec
+DELETE FROM webauthn_challenges
+WHERE expires_at <= NOW();
+
+-- name: CreateWebAuthnCredential :one
+INSERT INTO webauthn_credentials (id, user_id, credential_id, public_key, sign_count, name, created_at)
+VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, NOW())
+RETURNING *;
+
+-- name: GetWebAuthnCredential :one
+SELECT * FROM webauthn_credentials
+WHERE credential_id = $1;
+
+-- name: ListUserWebAuthnCredentials :many
+SELECT * FROM webauthn_credentials
+WHERE user_id = $1
+ORDER BY created_at ASC;
+
+-- name: ListUserWebAuthnCredentialIDs :many
+SELECT credential_id FROM webauthn_credentials
+WHERE user_id = $1;
+
+-- name: UseWebAuthnCredential :execrows
+UPDATE webauthn_credentials
+SET sign_count = sqlc.arg('new_sign_count'), last_used_at = NOW()
+WHERE id = sqlc.arg('id') AND sign_count = sqlc.arg('old_sign_count');
+
+-- name: DeleteWebAuthnCredential :execrows
+DELETE FROM webauthn_credentials
+WHERE id = $1 AND user_id = $2;
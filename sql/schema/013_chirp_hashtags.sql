@@ -0,0 +1,20 @@
+-- +goose Up
+CREATE TABLE chirp_hashtags(
+  chirp_id UUID NOT NULL,
+  tag TEXT NOT NULL,
+  created_at TIMESTAMP NOT NULL,
+  PRIMARY KEY(chirp_id, tag),
+  FOREIGN KEY(chirp_id) REFERENCES chirps(id) ON DELETE CASCADE
+);
+
+CREATE INDEX chirp_hashtags_tag_created_at_idx ON chirp_hashtags (tag, created_at);
+CREATE INDEX chirp_hashtags_created_at_idx ON chirp_hashtags (created_at);
+
+INSERT INTO chirp_hashtags (chirp_id, tag, created_at)
+SELECT DISTINCT chirps.id, lower(match[1]), chirps.created_at
+FROM chirps, regexp_matches(chirps.body, '(?:^|[^[:alnum:]_&])#([[:alnum:]_]*[[:alpha:]][[:alnum:]_]*)', 'g') AS match
+WHERE chirps.deleted_at IS NULL
+  AND octet_length(lower(match[1])) <= 100;
+
+-- +goose Down
+DROP TABLE chirp_hashtags;
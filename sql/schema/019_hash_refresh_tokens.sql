@@ -0,0 +1,27 @@
+-- +goose Up
+-- Only a digest of each refresh token is kept. The first 16 characters of
+-- the token are stored in the clear as its ID so it can be looked up.
+ALTER TABLE refresh_tokens
+ADD COLUMN id TEXT,
+ADD COLUMN token_hash TEXT;
+
+UPDATE refresh_tokens
+SET id = left(token, 16), token_hash = encode(sha256(token::bytea), 'hex');
+
+ALTER TABLE refresh_tokens
+DROP CONSTRAINT refresh_tokens_pkey,
+DROP COLUMN token,
+ALTER COLUMN id SET NOT NULL,
+ALTER COLUMN token_hash SET NOT NULL,
+ADD PRIMARY KEY (id);
+
+-- +goose Down
+-- Raw tokens can't be recovered from their digests, so every session is
+-- signed out.
+DELETE FROM refresh_tokens;
+
+ALTER TABLE refresh_tokens
+DROP CONSTRAINT refresh_tokens_pkey,
+DROP COLUMN id,
+DROP COLUMN token_hash,
+ADD COLUMN token TEXT PRIMARY KEY;
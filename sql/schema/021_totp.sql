@@ -0,0 +1,23 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN totp_secret TEXT,
+ADD COLUMN totp_enabled_at TIMESTAMP,
+ADD COLUMN totp_last_used_step BIGINT;
+
+CREATE TABLE recovery_codes(
+  id UUID PRIMARY KEY,
+  user_id UUID NOT NULL,
+  code_hash TEXT NOT NULL,
+  created_at TIMESTAMP NOT NULL,
+  used_at TIMESTAMP,
+  UNIQUE(user_id, code_hash),
+  FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE recovery_codes;
+
+ALTER TABLE users
+DROP COLUMN totp_last_used_step,
+DROP COLUMN totp_enabled_at,
+DROP COLUMN totp_secret;
@@ -0,0 +1,34 @@
+-- +goose Up
+CREATE TABLE webauthn_credentials(
+  id UUID PRIMARY KEY,
+  user_id UUID NOT NULL,
+  credential_id BYTEA NOT NULL,
+  public_key BYTEA NOT NULL,
+  sign_count BIGINT NOT NULL,
+  name TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMP NOT NULL,
+  last_used_at TIMESTAMP,
+  CONSTRAINT webauthn_credentials_credential_id_key UNIQUE(credential_id),
+  FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX webauthn_credentials_user_id_idx ON webauthn_credentials (user_id);
+
+-- A challenge is issued when a ceremony begins and deleted when it
+-- finishes, so each can only be answered once. Login challenges have no
+-- user because the passkey itself says who is signing in.
+CREATE TABLE webauthn_challenges(
+  id UUID PRIMARY KEY,
+  user_id UUID,
+  purpose TEXT NOT NULL,
+  challenge BYTEA NOT NULL,
+  created_at TIMESTAMP NOT NULL,
+  expires_at TIMESTAMP NOT NULL,
+  FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX webauthn_challenges_expires_at_idx ON webauthn_challenges (expires_at);
+
+-- +goose Down
+DROP TABLE webauthn_challenges;
+DROP TABLE webauthn_credentials;
@@ -0,0 +1,29 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN suspended_until TIMESTAMP,
+ADD COLUMN banned_at TIMESTAMP;
+
+-- The log outlives the chirps moderators remove, so target_chirp_id isn't
+-- a foreign key.
+CREATE TABLE moderation_actions(
+  id UUID PRIMARY KEY,
+  moderator_id UUID,
+  action TEXT NOT NULL CHECK (action IN ('suspend', 'ban', 'reinstate', 'remove_chirp')),
+  target_user_id UUID,
+  target_chirp_id UUID,
+  reason TEXT NOT NULL,
+  suspended_until TIMESTAMP,
+  created_at TIMESTAMP NOT NULL,
+  FOREIGN KEY(moderator_id) REFERENCES users(id) ON DELETE SET NULL,
+  FOREIGN KEY(target_user_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX moderation_actions_created_at_idx ON moderation_actions (created_at DESC, id DESC);
+CREATE INDEX moderation_actions_target_user_id_idx ON moderation_actions (target_user_id);
+
+-- +goose Down
+DROP TABLE moderation_actions;
+
+ALTER TABLE users
+DROP COLUMN banned_at,
+DROP COLUMN suspended_until;
@@ -0,0 +1,44 @@
+-- +goose Up
+CREATE TABLE reports(
+  id UUID PRIMARY KEY,
+  reporter_id UUID NOT NULL,
+  -- Set for chirp reports, whose user_id is the chirp's author. Reports
+  -- outlive the chirps removed because of them, so it isn't a foreign key.
+  chirp_id UUID,
+  user_id UUID NOT NULL,
+  category TEXT NOT NULL CHECK (category IN ('spam', 'harassment', 'hate_speech', 'violence', 'sexual_content', 'impersonation', 'other')),
+  details TEXT NOT NULL DEFAULT '',
+  status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'claimed', 'resolved', 'dismissed')),
+  assignee_id UUID,
+  resolution TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMP NOT NULL,
+  updated_at TIMESTAMP NOT NULL,
+  claimed_at TIMESTAMP,
+  closed_at TIMESTAMP,
+  FOREIGN KEY(reporter_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY(assignee_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- Each user can report a chirp, or an account, once.
+CREATE UNIQUE INDEX reports_reporter_chirp_key ON reports (reporter_id, chirp_id) WHERE chirp_id IS NOT NULL;
+CREATE UNIQUE INDEX reports_reporter_user_key ON reports (reporter_id, user_id) WHERE chirp_id IS NULL;
+CREATE INDEX reports_status_created_at_idx ON reports (status, created_at, id);
+
+ALTER TABLE moderation_actions
+ADD COLUMN report_id UUID REFERENCES reports(id) ON DELETE SET NULL,
+DROP CONSTRAINT moderation_actions_action_check,
+ADD CONSTRAINT moderation_actions_action_check
+  CHECK (action IN ('suspend', 'ban', 'reinstate', 'remove_chirp', 'claim_report', 'resolve_report', 'dismiss_report'));
+
+-- +goose Down
+DELETE FROM moderation_actions
+WHERE action IN ('claim_report', 'resolve_report', 'dismiss_report');
+
+ALTER TABLE moderation_actions
+DROP CONSTRAINT moderation_actions_action_check,
+ADD CONSTRAINT moderation_actions_action_check
+  CHECK (action IN ('suspend', 'ban', 'reinstate', 'remove_chirp')),
+DROP COLUMN report_id;
+
+DROP TABLE reports;
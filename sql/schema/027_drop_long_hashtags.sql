@@ -0,0 +1,9 @@
+-- +goose Up
+-- The backfill in 013 indexed tags of any length, but chirps only index
+-- tags of up to 100 bytes.
+DELETE FROM chirp_hashtags
+WHERE octet_length(tag) > 100;
+
+-- +goose Down
+-- The dropped tags were never meant to be indexed, so they aren't restored.
+SELECT 1;
@@ -0,0 +1,19 @@
+-- +goose Up
+-- Likes now always go to the chirp a rechirp reposts. Move the ones left on
+-- rechirps over, keeping the earlier like when a user had both.
+INSERT INTO likes (user_id, chirp_id, created_at)
+SELECT likes.user_id, chirps.rechirp_of_id, likes.created_at
+FROM likes
+JOIN chirps ON chirps.id = likes.chirp_id
+WHERE chirps.rechirp_of_id IS NOT NULL
+ON CONFLICT (user_id, chirp_id) DO UPDATE
+SET created_at = LEAST(likes.created_at, EXCLUDED.created_at);
+
+DELETE FROM likes
+USING chirps
+WHERE chirps.id = likes.chirp_id
+  AND chirps.rechirp_of_id IS NOT NULL;
+
+-- +goose Down
+-- Which likes were moved isn't recorded, so they stay on the originals.
+SELECT 1;
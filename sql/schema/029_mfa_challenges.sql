@@ -0,0 +1,18 @@
+-- +goose Up
+-- Each challenge token handed out by a password login that still needs a
+-- second factor. attempts counts codes tried against it, so guessing is
+-- capped per challenge and, across recent challenges, per user.
+CREATE TABLE mfa_challenges(
+  id UUID PRIMARY KEY,
+  user_id UUID NOT NULL,
+  created_at TIMESTAMP NOT NULL,
+  expires_at TIMESTAMP NOT NULL,
+  attempts INTEGER NOT NULL DEFAULT 0,
+  used_at TIMESTAMP,
+  FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX mfa_challenges_user_id_created_at_idx ON mfa_challenges (user_id, created_at);
+
+-- +goose Down
+DROP TABLE mfa_challenges;
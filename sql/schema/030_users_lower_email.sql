@@ -0,0 +1,7 @@
+-- +goose Up
+-- Emails are stored lowercased, but accounts created before that may not
+-- be, so lookups by email compare lowercased.
+CREATE INDEX users_lower_email_idx ON users (lower(email));
+
+-- +goose Down
+DROP INDEX users_lower_email_idx;
@@ -0,0 +1,38 @@
+-- +goose Up
+-- A reporter can report the same chirp or account again once their earlier
+-- report is closed.
+DROP INDEX reports_reporter_chirp_key;
+DROP INDEX reports_reporter_user_key;
+CREATE UNIQUE INDEX reports_reporter_chirp_key ON reports (reporter_id, chirp_id)
+  WHERE chirp_id IS NOT NULL AND status IN ('open', 'claimed');
+CREATE UNIQUE INDEX reports_reporter_user_key ON reports (reporter_id, user_id)
+  WHERE chirp_id IS NULL AND status IN ('open', 'claimed');
+
+-- Deleting a reported account keeps the reports against it.
+ALTER TABLE reports
+ALTER COLUMN user_id DROP NOT NULL,
+DROP CONSTRAINT reports_user_id_fkey,
+ADD CONSTRAINT reports_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL;
+
+-- +goose Down
+DELETE FROM reports WHERE user_id IS NULL;
+
+ALTER TABLE reports
+ALTER COLUMN user_id SET NOT NULL,
+DROP CONSTRAINT reports_user_id_fkey,
+ADD CONSTRAINT reports_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+-- Keep only the newest report of each target by each reporter.
+DELETE FROM reports
+WHERE EXISTS (
+  SELECT 1 FROM reports newer
+  WHERE newer.reporter_id = reports.reporter_id
+    AND newer.user_id = reports.user_id
+    AND newer.chirp_id IS NOT DISTINCT FROM reports.chirp_id
+    AND (newer.created_at, newer.id) > (reports.created_at, reports.id)
+);
+
+DROP INDEX reports_reporter_chirp_key;
+DROP INDEX reports_reporter_user_key;
+CREATE UNIQUE INDEX reports_reporter_chirp_key ON reports (reporter_id, chirp_id) WHERE chirp_id IS NOT NULL;
+CREATE UNIQUE INDEX reports_reporter_user_key ON reports (reporter_id, user_id) WHERE chirp_id IS NULL;